@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/phrase/phraseapp-go/phraseapp"
+)
+
+// cleanupBackup contains the keys deleted by a cleanup together with all
+// their translations, so they can be restored later on.
+type cleanupBackup struct {
+	path string
+
+	ProjectID string       `json:"project_id"`
+	Keys      []*backupKey `json:"keys"`
+}
+
+type backupKey struct {
+	Key          *phraseapp.TranslationKey `json:"key"`
+	Translations []*phraseapp.Translation  `json:"translations"`
+}
+
+func newCleanupBackup(path, projectID string) *cleanupBackup {
+	return &cleanupBackup{path: path, ProjectID: projectID, Keys: []*backupKey{}}
+}
+
+func loadCleanupBackup(path string) (*cleanupBackup, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	backup := &cleanupBackup{path: path}
+	if err := json.Unmarshal(content, backup); err != nil {
+		return nil, fmt.Errorf("%s is not a valid cleanup backup: %s", path, err)
+	}
+	return backup, nil
+}
+
+// add fetches the translations of the keys and writes them to the backup
+// file together with all keys added before.
+func (backup *cleanupBackup) add(client *phraseapp.Client, keys []*phraseapp.TranslationKey) error {
+	for _, key := range keys {
+		translations, err := translationsByKey(client, backup.ProjectID, key.ID)
+		if err != nil {
+			return fmt.Errorf("Error fetching translations of key %q: %s", key.Name, err)
+		}
+		backup.Keys = append(backup.Keys, &backupKey{Key: key, Translations: translations})
+	}
+
+	content, err := json.MarshalIndent(backup, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(backup.path, append(content, '\n'), 0600)
+}
+
+func translationsByKey(client *phraseapp.Client, projectID, keyID string) ([]*phraseapp.Translation, error) {
+	const perPage = 100
+
+	result := []*phraseapp.Translation{}
+	for page := 1; ; page++ {
+		translations, err := client.TranslationsByKey(projectID, keyID, page, perPage, nil)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, translations...)
+		if len(translations) < perPage {
+			return result, nil
+		}
+	}
+}
+
+type UploadCleanupRestoreCommand struct {
+	phraseapp.Config
+	File string `cli:"arg required"`
+}
+
+func (cmd *UploadCleanupRestoreCommand) Run() error {
+	client, err := newClient(cmd.Config.Credentials, cmd.Config.Debug)
+	if err != nil {
+		return err
+	}
+
+	backup, err := loadCleanupBackup(cmd.File)
+	if err != nil {
+		return err
+	}
+
+	keys, translations, err := backup.restore(client)
+	fmt.Printf("Restored %d key(s) with %d translation(s) in project %s.\n", keys, translations, backup.ProjectID)
+	return err
+}
+
+// restore creates all keys of the backup and their translations again and
+// returns how many of them were created.
+func (backup *cleanupBackup) restore(client *phraseapp.Client) (keys, translations int, err error) {
+	for _, bk := range backup.Keys {
+		key := bk.Key
+		params := &phraseapp.TranslationKeyParams{
+			Name:        &key.Name,
+			Description: &key.Description,
+			Plural:      &key.Plural,
+		}
+		if key.DataType != "" {
+			params.DataType = &key.DataType
+		}
+		if len(key.Tags) > 0 {
+			tags := strings.Join(key.Tags, ",")
+			params.Tags = &tags
+		}
+
+		created, err := client.KeyCreate(backup.ProjectID, params)
+		if err != nil {
+			return keys, translations, fmt.Errorf("Error restoring key %q: %s", key.Name, err)
+		}
+		keys++
+
+		for _, t := range bk.Translations {
+			if t.Locale == nil {
+				continue
+			}
+
+			params := &phraseapp.TranslationParams{
+				KeyID:      &created.ID,
+				LocaleID:   &t.Locale.ID,
+				Content:    &t.Content,
+				Excluded:   &t.Excluded,
+				Unverified: &t.Unverified,
+			}
+			if t.PluralSuffix != "" {
+				params.PluralSuffix = &t.PluralSuffix
+			}
+
+			if _, err := client.TranslationCreate(backup.ProjectID, params); err != nil {
+				return keys, translations, fmt.Errorf("Error restoring translation of key %q for locale %q: %s", key.Name, t.Locale.Code, err)
+			}
+			translations++
+		}
+	}
+	return keys, translations, nil
+}
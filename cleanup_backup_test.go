@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/phrase/phraseapp-go/phraseapp"
+)
+
+// keysHandler serves a project with a single key unmentioned in any upload
+// and records all requests changing the project.
+type keysHandler struct {
+	deleted bool
+	changes []string
+}
+
+func (kh *keysHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	var body []byte
+	if req.Header.Get("Content-Type") == "application/json" {
+		body, _ = ioutil.ReadAll(req.Body)
+	}
+
+	switch {
+	case req.Method == "GET" && strings.HasSuffix(req.URL.Path, "/keys"):
+		if kh.deleted || req.URL.Query().Get("page") != "1" {
+			fmt.Fprint(resp, `[]`)
+			return
+		}
+		fmt.Fprint(resp, `[{"id": "key-id", "name": "obsolete", "description": "old", "tags": ["a", "b"]}]`)
+	case req.Method == "GET" && strings.HasSuffix(req.URL.Path, "/keys/key-id/translations"):
+		fmt.Fprint(resp, `[{"id": "t1", "content": "veraltet", "locale": {"id": "de-locale-id", "code": "de"}}]`)
+	case req.Method == "DELETE":
+		kh.deleted = true
+		kh.changes = append(kh.changes, "DELETE "+strings.TrimSpace(string(body)))
+		fmt.Fprint(resp, `{"records_affected": 1}`)
+	case req.Method == "POST" && strings.HasSuffix(req.URL.Path, "/keys"):
+		if err := req.ParseMultipartForm(1 << 20); err != nil {
+			resp.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		kh.changes = append(kh.changes, fmt.Sprintf("KEY name=%s description=%s tags=%s",
+			req.FormValue("name"), req.FormValue("description"), req.FormValue("tags")))
+		resp.WriteHeader(http.StatusCreated)
+		fmt.Fprint(resp, `{"id": "new-key-id"}`)
+	case req.Method == "POST" && strings.HasSuffix(req.URL.Path, "/translations"):
+		kh.changes = append(kh.changes, "TRANSLATION "+strings.TrimSpace(string(body)))
+		resp.WriteHeader(http.StatusCreated)
+		fmt.Fprint(resp, `{"id": "new-translation-id"}`)
+	default:
+		resp.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestUploadCleanupBackupAndRestore(t *testing.T) {
+	d, err := ioutil.TempDir("", "phrase-cleanup-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(d)
+
+	kh := new(keysHandler)
+	srv := httptest.NewServer(kh)
+	defer srv.Close()
+
+	c, err := newClient(phraseapp.Credentials{Host: srv.URL, Token: "some_token"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deleted, err := uploadCleanup(c, "project-id", []string{"upload-id"}, cleanupOptions{DryRun: true}, ioutil.Discard)
+	if err != nil || deleted != 0 || len(kh.changes) != 0 {
+		t.Fatalf("expected dry run not to delete anything, got %d deleted, changes %v, error %v", deleted, kh.changes, err)
+	}
+
+	backupPath := filepath.Join(d, "backup.json")
+	deleted, err = uploadCleanup(c, "project-id", []string{"upload-id"}, cleanupOptions{Confirm: true, Backup: backupPath}, ioutil.Discard)
+	if err != nil || deleted != 1 {
+		t.Fatalf("expected 1 deleted key, got %d, error %v", deleted, err)
+	}
+
+	backup, err := loadCleanupBackup(backupPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if backup.ProjectID != "project-id" || len(backup.Keys) != 1 || backup.Keys[0].Key.Name != "obsolete" || len(backup.Keys[0].Translations) != 1 {
+		content, _ := json.Marshal(backup)
+		t.Fatalf("unexpected backup: %s", content)
+	}
+
+	kh.changes = nil
+	keys, translations, err := backup.restore(c)
+	if err != nil || keys != 1 || translations != 1 {
+		t.Fatalf("expected 1 key and 1 translation to be restored, got %d and %d, error %v", keys, translations, err)
+	}
+
+	exp := []string{
+		`KEY name=obsolete description=old tags=a,b`,
+		`TRANSLATION {"content":"veraltet","excluded":false,"key_id":"new-key-id","locale_id":"de-locale-id","unverified":false}`,
+	}
+	if strings.Join(kh.changes, "\n") != strings.Join(exp, "\n") {
+		t.Errorf("expected requests\n%s\ngot\n%s", strings.Join(exp, "\n"), strings.Join(kh.changes, "\n"))
+	}
+}
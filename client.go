@@ -11,12 +11,20 @@ import (
 )
 
 func newClient(creds phraseapp.Credentials, debug bool) (*phraseapp.Client, error) {
+	return newClientWithRetries(creds, debug, DefaultMaxRetries)
+}
+
+// newClientWithRetries returns a client that retries requests failing due to
+// rate limiting or transient errors up to maxRetries times.
+func newClientWithRetries(creds phraseapp.Credentials, debug bool, maxRetries int) (*phraseapp.Client, error) {
 	c, err := phraseapp.NewClient(creds, debug)
 	if err != nil {
 		return nil, err
 	}
+
+	var tr http.RoundTripper = http.DefaultTransport
 	if os.Getenv("PHRASEAPP_INSECURE_SKIP_VERIFY") == "true" {
-		tr := &http.Transport{
+		tr = &http.Transport{
 			Proxy: http.ProxyFromEnvironment,
 			Dial: (&net.Dialer{
 				Timeout:   30 * time.Second,
@@ -26,7 +34,32 @@ func newClient(creds phraseapp.Credentials, debug bool) (*phraseapp.Client, erro
 			ExpectContinueTimeout: 1 * time.Second,
 			TLSClientConfig:       &tls.Config{InsecureSkipVerify: true},
 		}
-		c.Client = http.Client{Transport: tr}
 	}
+
+	if maxRetries > 0 {
+		tr = newRetryTransport(tr, maxRetries)
+	}
+	c.Client = http.Client{Transport: tr}
 	return c, nil
 }
+
+// withCredentials returns a copy of client using the given access token and
+// host instead of the ones of the config. If neither is set, client itself is
+// returned. The copy shares the transport with client.
+func withCredentials(client *phraseapp.Client, accessToken, host string) *phraseapp.Client {
+	if accessToken == "" && host == "" {
+		return client
+	}
+
+	c := new(phraseapp.Client)
+	*c = *client
+	if accessToken != "" {
+		c.Credentials.Token = accessToken
+		c.Credentials.Username = ""
+		c.Credentials.TFA = false
+	}
+	if host != "" {
+		c.Credentials.Host = host
+	}
+	return c
+}
@@ -0,0 +1,568 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+
+	"github.com/phrase/phraseapp-client/internal/paths"
+	"github.com/phrase/phraseapp-go/phraseapp"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// configDir is the directory relative file patterns and files written next
+// to the config are resolved against. It is empty for the config in the home
+// directory, which is shared by all projects, so the working directory is
+// used instead.
+var configDir string
+
+// readConfig reads the config file like phraseapp.ReadConfig, but handles the
+// keys only known to the client before parsing it, see loadConfigDoc and
+// preprocessConfig. The file at path is read, if given, otherwise the one
+// found by configPath. The path of the file read is returned, empty if there
+// is none. The profile, if given, is applied on top of the config, see
+// applyProfile.
+func readConfig(path, profile string) (*phraseapp.Config, string, error) {
+	cfg := &phraseapp.Config{}
+
+	path, dir, err := configPath(path)
+	if err != nil {
+		return nil, path, err
+	}
+	if path == "" {
+		if profile != "" {
+			return nil, path, fmt.Errorf("profile %q selected, but no config file found", profile)
+		}
+		return cfg, path, nil
+	}
+
+	doc, err := loadConfigDoc(path, nil)
+	if err != nil {
+		return nil, path, err
+	}
+
+	content, err := yaml.Marshal(doc)
+	if err != nil {
+		return nil, path, err
+	}
+
+	if content, err = preprocessConfig(content, dir, profile); err != nil {
+		return nil, path, fmt.Errorf("%s: %s", path, err)
+	}
+
+	rawCfg := struct{ PhraseApp *phraseapp.Config }{PhraseApp: cfg}
+	if err := yaml.Unmarshal(content, rawCfg); err != nil {
+		return nil, path, err
+	}
+
+	configDir = dir
+	return cfg, path, nil
+}
+
+// configPath returns the absolute path of the config file to use and the
+// directory to resolve relative paths against. The file is the given one, the
+// one from PHRASEAPP_CONFIG, the first found in the working directory or its
+// parents up to the repository root, or the one in the home directory, in
+// that order. An empty path is returned if there is none.
+func configPath(explicitPath string) (path, dir string, err error) {
+	source := "--config option"
+	if explicitPath == "" {
+		explicitPath = os.Getenv("PHRASEAPP_CONFIG")
+		source = "PHRASEAPP_CONFIG environment variable"
+	}
+
+	if explicitPath != "" {
+		if _, err := os.Stat(explicitPath); err != nil {
+			if os.IsNotExist(err) {
+				err = fmt.Errorf("file %q (from %s) doesn't exist", explicitPath, source)
+			}
+			return "", "", err
+		}
+		path, err := filepath.Abs(explicitPath)
+		return path, filepath.Dir(path), err
+	}
+
+	home := os.Getenv("HOME")
+	if runtime.GOOS == "windows" {
+		home = os.Getenv("HomePath")
+	}
+
+	wd, err := os.Getwd()
+	if err == nil {
+		if path := findConfigUpwards(wd, home); path != "" {
+			return path, filepath.Dir(path), nil
+		}
+	}
+
+	if path := filepath.Join(home, paths.YamlConfigName); home != "" && fileExists(path) {
+		return path, "", nil
+	}
+	return "", "", nil
+}
+
+// findConfigUpwards returns the path of the config file in dir or the closest
+// of its parents, without leaving the repository dir is in. The search stops
+// before the home directory, as the config there isn't a project config.
+func findConfigUpwards(dir, home string) string {
+	if home != "" {
+		home = filepath.Clean(home)
+	}
+	for {
+		if dir == home {
+			return ""
+		}
+		if path := filepath.Join(dir, paths.YamlConfigName); fileExists(path) {
+			return path
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir || fileExists(filepath.Join(dir, ".git")) {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// includeKeys name other config files to merge into a config, which
+// overrides their values. Paths are relative to the including file.
+var includeKeys = []string{"extends", "include"}
+
+// configKeys are the keys allowed in the phraseapp section of a config.
+var configKeys = map[string]bool{
+	"access_token":   true,
+	"host":           true,
+	"debug":          true,
+	"page":           true,
+	"perpage":        true,
+	"project_id":     true,
+	"file_format":    true,
+	"push":           true,
+	"pull":           true,
+	"defaults":       true,
+	"locale_mapping": true,
+	"profiles":       true,
+	"extends":        true,
+	"include":        true,
+}
+
+// loadConfigDoc reads the config file at path and deep merges the files it
+// includes into it, in the given order. stack contains the files including
+// the file, to detect cycles.
+func loadConfigDoc(path string, stack []string) (yaml.MapSlice, error) {
+	for _, including := range stack {
+		if including == path {
+			return nil, fmt.Errorf("config files include each other: %s", strings.Join(append(stack, path), " -> "))
+		}
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		if len(stack) > 0 {
+			err = fmt.Errorf("%s (included by %s)", err, stack[len(stack)-1])
+		}
+		return nil, err
+	}
+
+	doc := yaml.MapSlice{}
+	if err := yaml.Unmarshal(content, &doc); err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+
+	if len(stack) > 0 {
+		// keys of included files are checked on their own, as errors
+		// wouldn't tell which file they came from after merging
+		if err := validateIncludedConfig(doc); err != nil {
+			return nil, fmt.Errorf("%s (included by %s): %s", path, stack[len(stack)-1], err)
+		}
+	}
+
+	includes := []string{}
+	for i, item := range doc {
+		cfg, ok := item.Value.(yaml.MapSlice)
+		if item.Key != "phraseapp" || !ok {
+			continue
+		}
+
+		for _, key := range includeKeys {
+			var value interface{}
+			value, cfg = removeKey(cfg, key)
+			paths, err := parseIncludes(key, value)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s", path, err)
+			}
+			includes = append(includes, paths...)
+		}
+		doc[i].Value = cfg
+	}
+
+	stack = append(append([]string{}, stack...), path)
+	merged := yaml.MapSlice{}
+	for _, include := range includes {
+		if !filepath.IsAbs(include) {
+			include = filepath.Join(filepath.Dir(path), include)
+		}
+
+		included, err := loadConfigDoc(include, stack)
+		if err != nil {
+			return nil, err
+		}
+		merged = deepMerge(merged, included)
+	}
+	return deepMerge(merged, doc), nil
+}
+
+// parseIncludes returns the paths given as single string or list.
+func parseIncludes(key string, value interface{}) ([]string, error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []string{v}, nil
+	case []interface{}:
+		paths := []string{}
+		for _, p := range v {
+			path, ok := p.(string)
+			if !ok {
+				return nil, fmt.Errorf("configuration key %q has invalid value: %T", key, p)
+			}
+			paths = append(paths, path)
+		}
+		return paths, nil
+	default:
+		return nil, fmt.Errorf("configuration key %q has invalid value: %T", key, value)
+	}
+}
+
+// validateIncludedConfig checks the keys of the phraseapp section and its
+// sources and targets.
+func validateIncludedConfig(doc yaml.MapSlice) error {
+	cfg, ok := valueOf(doc, "phraseapp").(yaml.MapSlice)
+	if !ok {
+		return nil
+	}
+
+	for _, item := range cfg {
+		if key := fmt.Sprint(item.Key); !configKeys[key] {
+			return fmt.Errorf("configuration key %q unknown", key)
+		}
+	}
+
+	for key, sections := range map[string]interface{}{
+		"push": &struct{ Sources Sources }{},
+		"pull": &struct{ Targets Targets }{},
+	} {
+		section := valueOf(cfg, key)
+		if section == nil {
+			continue
+		}
+
+		content, err := yaml.Marshal(section)
+		if err != nil {
+			return err
+		}
+
+		// values are validated as they will be read, with environment
+		// variables expanded. The section is copied for that, as expanding
+		// happens once all files were merged and the profile was applied.
+		// Variables that aren't set are reported then, too.
+		expanded := yaml.MapSlice{}
+		if err := yaml.Unmarshal(content, &expanded); err != nil {
+			return fmt.Errorf("%s: %s", key, err)
+		}
+		if _, err := expandEnvInValues(expanded, key); err != nil {
+			continue
+		}
+		if content, err = yaml.Marshal(expanded); err != nil {
+			return err
+		}
+
+		if err := yaml.Unmarshal(content, sections); err != nil {
+			return fmt.Errorf("%s: %s", key, err)
+		}
+	}
+	return nil
+}
+
+// deepMerge returns the entries of both maps, preferring the ones of override.
+// Nested maps are merged as well, all other values are replaced.
+func deepMerge(base, override yaml.MapSlice) yaml.MapSlice {
+	merged := append(yaml.MapSlice{}, base...)
+	for _, item := range override {
+		key := fmt.Sprint(item.Key)
+		overrideMap, ok := item.Value.(yaml.MapSlice)
+		if baseMap, baseOk := valueOf(merged, key).(yaml.MapSlice); ok && baseOk {
+			item.Value = deepMerge(baseMap, overrideMap)
+		}
+
+		found := false
+		for i, existing := range merged {
+			if fmt.Sprint(existing.Key) == key {
+				merged[i].Value = item.Value
+				found = true
+			}
+		}
+		if !found {
+			merged = append(merged, item)
+		}
+	}
+	return merged
+}
+
+// preprocessConfig rewrites the config content, so that it only contains keys
+// known to the phraseapp library. The profile is applied first, if given.
+// Environment variables in string values are expanded, see expandEnv. The
+// global locale_mapping is merged into the locale mappings of the push and
+// pull sections, which take precedence. Relative file patterns are made
+// absolute using dir, unless it's empty.
+func preprocessConfig(content []byte, dir, profile string) ([]byte, error) {
+	doc := yaml.MapSlice{}
+	if err := yaml.Unmarshal(content, &doc); err != nil {
+		return nil, err
+	}
+
+	// applied before expanding environment variables, so that the ones only
+	// used by other profiles don't need to be set
+	doc, err := applyProfile(doc, profile)
+	if err != nil {
+		return nil, err
+	}
+
+	expanded, err := expandEnvInValues(doc, "")
+	if err != nil {
+		return nil, err
+	}
+	doc = expanded.(yaml.MapSlice)
+
+	for i, item := range doc {
+		cfg, ok := item.Value.(yaml.MapSlice)
+		if item.Key != "phraseapp" || !ok {
+			// let the library report invalid content
+			continue
+		}
+
+		cfg, err := applyGlobalLocaleMapping(cfg)
+		if err != nil {
+			return nil, err
+		}
+		if dir != "" {
+			resolveFilePatterns(cfg, dir)
+		}
+		doc[i].Value = cfg
+	}
+
+	return yaml.Marshal(doc)
+}
+
+func applyGlobalLocaleMapping(cfg yaml.MapSlice) (yaml.MapSlice, error) {
+	value, cfg := removeKey(cfg, "locale_mapping")
+	if value == nil {
+		return cfg, nil
+	}
+
+	global, ok := value.(yaml.MapSlice)
+	if !ok {
+		return nil, fmt.Errorf("configuration key %q has invalid value: %T", "locale_mapping", value)
+	}
+
+	for i, item := range cfg {
+		section, ok := item.Value.(yaml.MapSlice)
+		if (item.Key != "push" && item.Key != "pull") || !ok {
+			continue
+		}
+
+		value, section := removeKey(section, "locale_mapping")
+		mapping := append(yaml.MapSlice{}, global...)
+		if value != nil {
+			own, ok := value.(yaml.MapSlice)
+			if !ok {
+				return nil, fmt.Errorf("configuration key %q has invalid value: %T", fmt.Sprintf("%s.locale_mapping", item.Key), value)
+			}
+			for _, entry := range own {
+				_, mapping = removeKey(mapping, fmt.Sprint(entry.Key))
+				mapping = append(mapping, entry)
+			}
+		}
+		cfg[i].Value = append(section, yaml.MapItem{Key: "locale_mapping", Value: mapping})
+	}
+	return cfg, nil
+}
+
+// profileKeys are the keys a profile can override. The push and pull sections
+// are merged with the ones of the base config, the others are replaced.
+var profileKeys = map[string]bool{
+	"host":           true,
+	"access_token":   true,
+	"project_id":     true,
+	"file_format":    true,
+	"locale_mapping": true,
+	"push":           true,
+	"pull":           true,
+}
+
+// applyProfile removes the profiles from the phraseapp section of doc and
+// applies the one with the given name, if any.
+func applyProfile(doc yaml.MapSlice, name string) (yaml.MapSlice, error) {
+	for i, item := range doc {
+		cfg, ok := item.Value.(yaml.MapSlice)
+		if item.Key != "phraseapp" || !ok {
+			continue
+		}
+
+		value, cfg := removeKey(cfg, "profiles")
+		doc[i].Value = cfg
+		if name == "" {
+			return doc, nil
+		}
+
+		profiles, ok := value.(yaml.MapSlice)
+		if value != nil && !ok {
+			return nil, fmt.Errorf("configuration key %q has invalid value: %T", "profiles", value)
+		}
+
+		profile, ok := valueOf(profiles, name).(yaml.MapSlice)
+		if !ok {
+			names := []string{}
+			for _, p := range profiles {
+				names = append(names, fmt.Sprint(p.Key))
+			}
+			return nil, fmt.Errorf("profile %q not found, available profiles: %s", name, strings.Join(names, ", "))
+		}
+
+		for _, override := range profile {
+			key := fmt.Sprint(override.Key)
+			if !profileKeys[key] {
+				return nil, fmt.Errorf("configuration key %q can't be set in profile %q", key, name)
+			}
+
+			value, cfg = removeKey(cfg, key)
+			base, baseOk := value.(yaml.MapSlice)
+			section, sectionOk := override.Value.(yaml.MapSlice)
+			if (key == "push" || key == "pull") && baseOk && sectionOk {
+				for _, entry := range section {
+					_, base = removeKey(base, fmt.Sprint(entry.Key))
+					base = append(base, entry)
+				}
+				override.Value = base
+			}
+			cfg = append(cfg, override)
+		}
+		doc[i].Value = cfg
+		return doc, nil
+	}
+
+	if name != "" {
+		return nil, fmt.Errorf("profile %q not found, the config has no phraseapp section", name)
+	}
+	return doc, nil
+}
+
+// envVariable matches ${VAR} and ${VAR:-default}.
+var envVariable = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// expandEnv replaces ${VAR} by the value of the environment variable VAR,
+// which must be set, and ${VAR:-default} by the value of VAR or default if VAR
+// is unset or empty. Any other text is left untouched.
+func expandEnv(s string) (string, error) {
+	var err error
+	expanded := envVariable.ReplaceAllStringFunc(s, func(match string) string {
+		groups := envVariable.FindStringSubmatch(match)
+		name, hasDefault, def := groups[1], groups[2] != "", groups[3]
+
+		value, ok := os.LookupEnv(name)
+		switch {
+		case hasDefault && value == "":
+			return def
+		case !ok && err == nil:
+			err = fmt.Errorf("environment variable %s is not set", name)
+		}
+		return value
+	})
+	return expanded, err
+}
+
+// expandEnvInValues expands environment variables in all string values within
+// value, which is found at path in the config.
+func expandEnvInValues(value interface{}, path string) (interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		expanded, err := expandEnv(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", path, err)
+		}
+		return expanded, nil
+	case yaml.MapSlice:
+		for i, item := range v {
+			key := fmt.Sprint(item.Key)
+			if path != "" {
+				key = path + "." + key
+			}
+
+			expanded, err := expandEnvInValues(item.Value, key)
+			if err != nil {
+				return nil, err
+			}
+			v[i].Value = expanded
+		}
+	case []interface{}:
+		for i, item := range v {
+			expanded, err := expandEnvInValues(item, fmt.Sprintf("%s[%d]", path, i))
+			if err != nil {
+				return nil, err
+			}
+			v[i] = expanded
+		}
+	}
+	return value, nil
+}
+
+// resolveFilePatterns joins relative file patterns of all sources and targets
+// with dir.
+func resolveFilePatterns(cfg yaml.MapSlice, dir string) {
+	lists := map[interface{}]string{"push": "sources", "pull": "targets"}
+	for _, item := range cfg {
+		section, ok := item.Value.(yaml.MapSlice)
+		if !ok || lists[item.Key] == "" {
+			continue
+		}
+
+		entries, _ := valueOf(section, lists[item.Key]).([]interface{})
+		for _, entry := range entries {
+			fields, _ := entry.(yaml.MapSlice)
+			for i, field := range fields {
+				file, ok := field.Value.(string)
+				if field.Key == "file" && ok && file != "" && !filepath.IsAbs(file) {
+					fields[i].Value = filepath.Join(dir, file)
+				}
+			}
+		}
+	}
+}
+
+// valueOf returns the value of key, or nil if it's not set.
+func valueOf(m yaml.MapSlice, key string) interface{} {
+	for _, item := range m {
+		if fmt.Sprint(item.Key) == key {
+			return item.Value
+		}
+	}
+	return nil
+}
+
+// removeKey returns the value of key and the map without it.
+func removeKey(m yaml.MapSlice, key string) (interface{}, yaml.MapSlice) {
+	for i, item := range m {
+		if fmt.Sprint(item.Key) == key {
+			return item.Value, append(m[:i:i], m[i+1:]...)
+		}
+	}
+	return nil, m
+}
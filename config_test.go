@@ -0,0 +1,495 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/phrase/phraseapp-go/phraseapp"
+	yaml "gopkg.in/yaml.v2"
+)
+
+func parseTestConfig(t *testing.T, content string) *phraseapp.Config {
+	return parseTestConfigWithProfile(t, content, "")
+}
+
+func parseTestConfigWithProfile(t *testing.T, content, profile string) *phraseapp.Config {
+	processed, err := preprocessConfig([]byte(content), "", profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &phraseapp.Config{}
+	rawCfg := struct{ PhraseApp *phraseapp.Config }{PhraseApp: cfg}
+	if err := yaml.Unmarshal(processed, rawCfg); err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
+
+func TestGlobalLocaleMapping(t *testing.T) {
+	cfg := parseTestConfig(t, `
+phraseapp:
+  project_id: project-id
+  locale_mapping:
+    pt-BR: pt-rBR
+    zh-CN: zh-Hans
+  push:
+    locale_mapping:
+      zh-CN: zh-CN
+    sources:
+    - file: ./<locale_code>.yml
+      locale_mapping:
+        pt-BR: pt
+  pull:
+    targets:
+    - file: ./<locale_code>.yml
+`)
+
+	sources, err := SourcesFromConfig(*cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for remote, exp := range map[string]string{"pt-BR": "pt", "zh-CN": "zh-CN", "en": "en"} {
+		if local := sources[0].LocaleMapping.local(remote); local != exp {
+			t.Errorf("expected source to map %q to %q, got %q", remote, exp, local)
+		}
+	}
+
+	targets, err := TargetsFromConfig(*cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for remote, exp := range map[string]string{"pt-BR": "pt-rBR", "zh-CN": "zh-Hans", "en": "en"} {
+		if local := targets[0].LocaleMapping.local(remote); local != exp {
+			t.Errorf("expected target to map %q to %q, got %q", remote, exp, local)
+		}
+	}
+}
+
+func TestLocaleMappingValidation(t *testing.T) {
+	cfg := parseTestConfig(t, `
+phraseapp:
+  locale_mapping:
+    zh-CN: zh-Hans
+  pull:
+    targets:
+    - file: ./<locale_code>.yml
+      locale_mapping:
+        zh-SG: zh-Hans
+`)
+
+	expect := `locale_mapping maps both "zh-CN" and "zh-SG" to "zh-Hans"`
+	if _, err := TargetsFromConfig(*cfg); err == nil || err.Error() != expect {
+		t.Errorf("expected error %q, got %v", expect, err)
+	}
+
+	if _, err := preprocessConfig([]byte("phraseapp:\n  locale_mapping: [pt-BR]\n"), "", ""); err == nil {
+		t.Errorf("expected a locale_mapping list to fail")
+	}
+}
+
+func TestConfigPath(t *testing.T) {
+	d := setupFiles(t,
+		"repo/.git/HEAD",
+		"repo/.phraseapp.yml",
+		"repo/sub/dir/file.txt",
+		"repo/nested/.phraseapp.yml",
+		"other/.phraseapp.yml",
+		"home/.phraseapp.yml",
+		"home/projects/app/file.txt",
+		"plain/.git/HEAD",
+		"plain/sub/file.txt",
+		".phraseapp.yml",
+	)
+	defer os.RemoveAll(d)
+	d, err := filepath.EvalSymlinks(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.Setenv("PHRASEAPP_CONFIG", os.Getenv("PHRASEAPP_CONFIG"))
+	defer os.Setenv("HOME", os.Getenv("HOME"))
+	os.Unsetenv("PHRASEAPP_CONFIG")
+	os.Setenv("HOME", filepath.Join(d, "home"))
+
+	for _, tc := range []struct {
+		wd, explicit, env string
+		path, dir         string
+	}{
+		{wd: "repo/sub/dir", path: "repo/.phraseapp.yml", dir: "repo"},
+		{wd: "repo/nested", path: "repo/nested/.phraseapp.yml", dir: "repo/nested"},
+		{wd: "repo/sub", env: "other/.phraseapp.yml", path: "other/.phraseapp.yml", dir: "other"},
+		{wd: "repo/sub", explicit: "other/.phraseapp.yml", env: "repo/.phraseapp.yml", path: "other/.phraseapp.yml", dir: "other"},
+		// the repository root stops the search, the config in home doesn't
+		// change the directory relative paths are resolved against
+		{wd: "plain/sub", path: "home/.phraseapp.yml"},
+		// the home directory stops the search outside of a repository
+		{wd: "home/projects/app", path: "home/.phraseapp.yml"},
+		{wd: "home", path: "home/.phraseapp.yml"},
+	} {
+		func() {
+			defer pushd(t, filepath.Join(d, tc.wd))()
+			os.Setenv("PHRASEAPP_CONFIG", "")
+			if tc.env != "" {
+				os.Setenv("PHRASEAPP_CONFIG", filepath.Join(d, tc.env))
+			}
+
+			explicit := tc.explicit
+			if explicit != "" {
+				explicit = filepath.Join(d, explicit)
+			}
+
+			path, dir, err := configPath(explicit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if exp := filepath.Join(d, tc.path); path != exp {
+				t.Errorf("%s: expected config %s, got %s", tc.wd, exp, path)
+			}
+			if exp := tc.dir; exp != "" {
+				exp = filepath.Join(d, exp)
+				if dir != exp {
+					t.Errorf("%s: expected directory %s, got %s", tc.wd, exp, dir)
+				}
+			} else if dir != "" {
+				t.Errorf("%s: expected no directory, got %s", tc.wd, dir)
+			}
+		}()
+	}
+
+	if _, _, err := configPath(filepath.Join(d, "missing.yml")); err == nil || !strings.Contains(err.Error(), "from --config option") {
+		t.Errorf("expected error for a missing config, got %v", err)
+	}
+}
+
+func TestReadConfigResolvesFilePatterns(t *testing.T) {
+	d, err := ioutil.TempDir("", "phrase-config-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(d)
+
+	path := filepath.Join(d, ".phraseapp.yml")
+	content := `
+phraseapp:
+  push:
+    sources:
+    - file: ./locales/<locale_code>.yml
+    - file: /abs/<locale_code>.yml
+  pull:
+    targets:
+    - file: locales/<locale_code>.yml
+`
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	defer func(dir string) { configDir = dir }(configDir)
+	cfg, configPath, err := readConfig(path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if configPath != path || configDir != d {
+		t.Errorf("expected config %s in %s, got %s in %s", path, d, configPath, configDir)
+	}
+
+	sources, err := SourcesFromConfig(*cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	targets, err := TargetsFromConfig(*cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, tc := range []struct{ got, exp string }{
+		{sources[0].File, filepath.Join(d, "locales", "<locale_code>.yml")},
+		{sources[1].File, "/abs/<locale_code>.yml"},
+		{targets[0].File, filepath.Join(d, "locales", "<locale_code>.yml")},
+	} {
+		if tc.got != tc.exp {
+			t.Errorf("%d: expected file pattern %s, got %s", i, tc.exp, tc.got)
+		}
+	}
+}
+
+func TestExpandEnv(t *testing.T) {
+	defer os.Unsetenv("PHRASEAPP_TEST_TOKEN")
+	defer os.Unsetenv("PHRASEAPP_TEST_EMPTY")
+	os.Setenv("PHRASEAPP_TEST_TOKEN", "secret")
+	os.Setenv("PHRASEAPP_TEST_EMPTY", "")
+	os.Unsetenv("PHRASEAPP_TEST_UNSET")
+
+	for in, exp := range map[string]string{
+		"${PHRASEAPP_TEST_TOKEN}":          "secret",
+		"a-${PHRASEAPP_TEST_TOKEN}-b":      "a-secret-b",
+		"${PHRASEAPP_TEST_UNSET:-default}": "default",
+		"${PHRASEAPP_TEST_EMPTY:-default}": "default",
+		"${PHRASEAPP_TEST_EMPTY}":          "",
+		"${PHRASEAPP_TEST_UNSET:-}":        "",
+		"$HOME costs $5 or $$5":            "$HOME costs $5 or $$5",
+	} {
+		got, err := expandEnv(in)
+		if err != nil {
+			t.Errorf("%s: unexpected error %s", in, err)
+		} else if got != exp {
+			t.Errorf("expected %q to expand to %q, got %q", in, exp, got)
+		}
+	}
+
+	cfg := parseTestConfig(t, `
+phraseapp:
+  access_token: ${PHRASEAPP_TEST_TOKEN}
+  project_id: ${PHRASEAPP_TEST_UNSET:-project-id}
+  push:
+    sources:
+    - file: ./${PHRASEAPP_TEST_TOKEN}/<locale_code>.yml
+      params:
+        tags: ${PHRASEAPP_TEST_UNSET:-web}
+`)
+	if cfg.Credentials.Token != "secret" || cfg.DefaultProjectID != "project-id" {
+		t.Errorf("expected token and project ID to be expanded, got %q and %q", cfg.Credentials.Token, cfg.DefaultProjectID)
+	}
+
+	sources, err := SourcesFromConfig(*cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sources[0].File != "./secret/<locale_code>.yml" || strings.Join(sources[0].tags(), ",") != "web" {
+		t.Errorf("expected file and params to be expanded, got %q and %v", sources[0].File, sources[0].tags())
+	}
+
+	_, err = preprocessConfig([]byte("phraseapp:\n  push:\n    sources:\n    - file: ${PHRASEAPP_TEST_UNSET}.yml\n"), "", "")
+	expect := "phraseapp.push.sources[0].file: environment variable PHRASEAPP_TEST_UNSET is not set"
+	if err == nil || err.Error() != expect {
+		t.Errorf("expected error %q, got %v", expect, err)
+	}
+}
+
+func TestConfigProfiles(t *testing.T) {
+	os.Unsetenv("PHRASEAPP_TEST_UNSET")
+	content := `
+phraseapp:
+  access_token: base-token
+  project_id: base-project
+  push:
+    parallel: 2
+    sources:
+    - file: ./<locale_code>.yml
+  profiles:
+    staging:
+      host: https://staging.example.com
+      project_id: staging-project
+      push:
+        sources:
+        - file: ./staging/<locale_code>.yml
+    production:
+      access_token: ${PHRASEAPP_TEST_UNSET}
+    invalid:
+      debug: true
+`
+
+	cfg := parseTestConfig(t, content)
+	if cfg.Credentials.Host != "" || cfg.DefaultProjectID != "base-project" {
+		t.Errorf("expected base config without profile, got host %q and project %q", cfg.Credentials.Host, cfg.DefaultProjectID)
+	}
+
+	cfg = parseTestConfigWithProfile(t, content, "staging")
+	if cfg.Credentials.Host != "https://staging.example.com" || cfg.DefaultProjectID != "staging-project" || cfg.Credentials.Token != "base-token" {
+		t.Errorf("expected staging profile on top of the base config, got %+v", cfg.Credentials)
+	}
+
+	sources, err := SourcesFromConfig(*cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	settings, err := PushSettingsFromConfig(*cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sources) != 1 || sources[0].File != "./staging/<locale_code>.yml" || settings.Parallel != 2 {
+		t.Errorf("expected push sources of staging profile merged with base push settings, got %v and %d", sources[0].File, settings.Parallel)
+	}
+
+	for profile, expect := range map[string]string{
+		"production": "phraseapp.access_token: environment variable PHRASEAPP_TEST_UNSET is not set",
+		"invalid":    `configuration key "debug" can't be set in profile "invalid"`,
+		"missing":    `profile "missing" not found, available profiles: staging, production, invalid`,
+	} {
+		_, err := preprocessConfig([]byte(content), "", profile)
+		if err == nil || err.Error() != expect {
+			t.Errorf("%s: expected error %q, got %v", profile, expect, err)
+		}
+	}
+}
+
+func writeConfigFiles(t *testing.T, files map[string]string) string {
+	d, err := ioutil.TempDir("", "phrase-config-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, content := range files {
+		path := filepath.Join(d, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return d
+}
+
+func TestConfigIncludes(t *testing.T) {
+	d := writeConfigFiles(t, map[string]string{
+		"shared/targets.yml": `
+phraseapp:
+  access_token: shared-token
+  pull:
+    parallel: 4
+    targets:
+    - file: ./locales/<locale_code>.yml
+`,
+		"shared/base.yml": `
+phraseapp:
+  extends: targets.yml
+  file_format: yml
+  project_id: shared-project
+`,
+		"app/.phraseapp.yml": `
+phraseapp:
+  include:
+  - ../shared/base.yml
+  project_id: app-project
+  pull:
+    retry: 1
+`,
+	})
+	defer os.RemoveAll(d)
+
+	defer func(dir string) { configDir = dir }(configDir)
+	cfg, _, err := readConfig(filepath.Join(d, "app", ".phraseapp.yml"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.Credentials.Token != "shared-token" || cfg.DefaultProjectID != "app-project" || cfg.DefaultFileFormat != "yml" {
+		t.Errorf("expected included values with local overrides, got %q, %q and %q", cfg.Credentials.Token, cfg.DefaultProjectID, cfg.DefaultFileFormat)
+	}
+
+	targets, err := TargetsFromConfig(*cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	settings, err := PullSettingsFromConfig(*cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(targets) != 1 || targets[0].ProjectID != "app-project" || settings.Parallel != 4 || settings.Retry == nil || *settings.Retry != 1 {
+		t.Errorf("expected pull section to be merged deeply, got %d targets and settings %+v", len(targets), settings)
+	}
+	// relative patterns are resolved against the directory of the main config
+	if exp := filepath.Join(d, "app", "locales", "<locale_code>.yml"); targets[0].File != exp {
+		t.Errorf("expected file pattern %s, got %s", exp, targets[0].File)
+	}
+}
+
+func TestConfigIncludeErrors(t *testing.T) {
+	d := writeConfigFiles(t, map[string]string{
+		"a.yml":        "phraseapp:\n  include: b.yml\n",
+		"b.yml":        "phraseapp:\n  include: a.yml\n",
+		"bad.yml":      "phraseapp:\n  include: fragment.yml\n",
+		"fragment.yml": "phraseapp:\n  pull:\n    targets:\n    - file: ./<locale_code>.yml\n      unknown_key: true\n",
+		"missing.yml":  "phraseapp:\n  include: nothing.yml\n",
+	})
+	defer os.RemoveAll(d)
+	defer func(dir string) { configDir = dir }(configDir)
+
+	path := func(name string) string { return filepath.Join(d, name) }
+	for name, expect := range map[string]string{
+		"a.yml":       "config files include each other: " + path("a.yml") + " -> " + path("b.yml") + " -> " + path("a.yml"),
+		"bad.yml":     path("fragment.yml") + " (included by " + path("bad.yml") + "): pull: configuration key \"unknown_key\" unknown",
+		"missing.yml": "(included by " + path("missing.yml") + ")",
+	} {
+		_, _, err := readConfig(path(name), "")
+		if err == nil || !strings.Contains(err.Error(), expect) {
+			t.Errorf("%s: expected error containing %q, got %v", name, expect, err)
+		}
+	}
+}
+
+func TestConfigIncludesExpandEnv(t *testing.T) {
+	d := writeConfigFiles(t, map[string]string{
+		".phraseapp.yml": "phraseapp:\n  project_id: project-id\n  include: shared.yml\n",
+		"shared.yml":     "phraseapp:\n  pull:\n    targets:\n    - file: ./<locale_code>.yml\n      file_mode: \"${PHRASEAPP_TEST_MODE}\"\n",
+	})
+	defer os.RemoveAll(d)
+	defer func(dir string) { configDir = dir }(configDir)
+	defer os.Unsetenv("PHRASEAPP_TEST_MODE")
+
+	os.Setenv("PHRASEAPP_TEST_MODE", "0644")
+	cfg, _, err := readConfig(filepath.Join(d, ".phraseapp.yml"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	targets, err := TargetsFromConfig(*cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(targets) != 1 || targets[0].FileMode != 0644 {
+		t.Errorf("expected file mode of included target to be expanded, got %v", targets)
+	}
+
+	// invalid values are still reported for the included file
+	os.Setenv("PHRASEAPP_TEST_MODE", "rw")
+	_, _, err = readConfig(filepath.Join(d, ".phraseapp.yml"), "")
+	if exp := filepath.Join(d, "shared.yml") + " (included by "; err == nil || !strings.Contains(err.Error(), exp) || !strings.Contains(err.Error(), "file_mode must be given in octal notation") {
+		t.Errorf("expected invalid file mode to be reported for shared.yml, got %v", err)
+	}
+}
+
+func TestTransferSettings(t *testing.T) {
+	cfg := parseTestConfig(t, `
+phraseapp:
+  push:
+    parallel: 3
+    sources:
+    - file: ./<locale_code>.yml
+  pull:
+    retry: 0
+    targets:
+    - file: ./<locale_code>.yml
+`)
+	push, err := PushSettingsFromConfig(*cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if push.Parallel != 3 || *push.MaxRetries() != DefaultMaxRetries {
+		t.Errorf("expected push settings to be read, got %+v", push)
+	}
+	pull, err := PullSettingsFromConfig(*cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pull.Parallel != 0 || *pull.MaxRetries() != 0 {
+		t.Errorf("expected pull settings to be read, got %+v", pull)
+	}
+
+	cfg = parseTestConfig(t, `
+phraseapp:
+  push:
+    retry: -1
+  pull:
+    parallel: -2
+`)
+	if _, err := PushSettingsFromConfig(*cfg); err == nil || err.Error() != "push.retry must not be negative, got -1" {
+		t.Errorf("expected negative retry to be rejected, got %v", err)
+	}
+	if _, err := PullSettingsFromConfig(*cfg); err == nil || err.Error() != "pull.parallel must not be negative, got -2" {
+		t.Errorf("expected negative parallel to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/phrase/phraseapp-client/internal/diff"
+	"github.com/phrase/phraseapp-go/phraseapp"
+	yaml "gopkg.in/yaml.v2"
+)
+
+type DiffCommand struct {
+	phraseapp.Config
+	Context    int  `cli:"opt --context desc='Number of unchanged lines shown around each change' default=3"`
+	MaxRetries *int `cli:"opt --max-retries desc='Number of times to retry failed requests'"`
+}
+
+// Like diff(1), the command exits with status 1 if files differ and with
+// status 2 if the comparison failed.
+const (
+	diffExitDiffering = 1
+	diffExitTrouble   = 2
+)
+
+// exitError sets the exit status of the client to code.
+type exitError struct {
+	error
+	code int
+}
+
+func (e *exitError) ExitCode() int {
+	return e.code
+}
+
+func (cmd *DiffCommand) Run() error {
+	differing, total, err := cmd.run()
+	switch {
+	case err != nil:
+		return &exitError{error: err, code: diffExitTrouble}
+	case differing > 0:
+		return &exitError{error: fmt.Errorf("%d of %d file(s) differ from PhraseApp", differing, total), code: diffExitDiffering}
+	}
+	return nil
+}
+
+// run prints the differences of all targets and returns how many of the
+// files differ out of the total number of files compared.
+func (cmd *DiffCommand) run() (differing, total int, err error) {
+	if cmd.Context < 0 {
+		return 0, 0, fmt.Errorf("--context must not be negative, got %d", cmd.Context)
+	}
+
+	if cmd.Config.Debug {
+		// suppresses content output
+		cmd.Config.Debug = false
+		Debug = true
+	}
+
+	targets, err := TargetsFromConfig(cmd.Config)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	settings, err := PullSettingsFromConfig(cmd.Config)
+	if err != nil {
+		return 0, 0, err
+	}
+	if cmd.MaxRetries == nil {
+		cmd.MaxRetries = settings.MaxRetries()
+	}
+
+	client, err := newClientWithRetries(cmd.Config.Credentials, cmd.Config.Debug, *cmd.MaxRetries)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if err := targets.fetchRemoteLocales(client); err != nil {
+		return 0, 0, err
+	}
+
+	jobs, err := targets.pullJobs(nil)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	for _, job := range jobs {
+		remote, err := job.target.Download(job.target.client(client), job.localeFile)
+		if err != nil {
+			return 0, 0, fmt.Errorf("%s for %s", err, job.localeFile.Path)
+		}
+
+		local, err := ioutil.ReadFile(job.localeFile.Path)
+		if err != nil && !os.IsNotExist(err) {
+			return 0, 0, err
+		}
+
+		relPath := job.localeFile.RelPath()
+		d := diff.Unified(local, remote, relPath+" (local)", relPath+" (PhraseApp)", cmd.Context)
+		if d == "" {
+			continue
+		}
+		differing++
+
+		fmt.Print(d)
+		if changes, err := keyDiff(local, remote, job.localeFile.Path); err != nil {
+			fmt.Printf("Could not compare the keys of %s: %s\n", relPath, err)
+		} else if len(changes) > 0 {
+			fmt.Printf("Changed keys in %s:\n", relPath)
+			for _, change := range changes {
+				fmt.Println("  " + change)
+			}
+		}
+		fmt.Println()
+	}
+
+	return differing, len(jobs), nil
+}
+
+// keyDiff compares the keys of structured locale files (YAML and JSON) and
+// returns one line per key that differs. Keys only present in remote are
+// prefixed with '+', those only present in local with '-', and keys having a
+// different value with '~'. Other file types result in no changes.
+func keyDiff(local, remote []byte, path string) ([]string, error) {
+	var unmarshal func([]byte, interface{}) error
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yml", ".yaml":
+		unmarshal = yaml.Unmarshal
+	case ".json":
+		unmarshal = json.Unmarshal
+	default:
+		return nil, nil
+	}
+
+	localKeys, remoteKeys := map[string]string{}, map[string]string{}
+	for _, c := range []struct {
+		content []byte
+		keys    map[string]string
+	}{{local, localKeys}, {remote, remoteKeys}} {
+		var v interface{}
+		if err := unmarshal(c.content, &v); err != nil {
+			return nil, err
+		}
+		flattenKeys("", v, c.keys)
+	}
+
+	changes := []string{}
+	for key, remoteValue := range remoteKeys {
+		localValue, found := localKeys[key]
+		switch {
+		case !found:
+			changes = append(changes, fmt.Sprintf("+ %s: %q", key, remoteValue))
+		case localValue != remoteValue:
+			changes = append(changes, fmt.Sprintf("~ %s: %q -> %q", key, localValue, remoteValue))
+		}
+	}
+	for key, localValue := range localKeys {
+		if _, found := remoteKeys[key]; !found {
+			changes = append(changes, fmt.Sprintf("- %s: %q", key, localValue))
+		}
+	}
+
+	// sort by key, not by the leading change marker
+	sort.Slice(changes, func(i, j int) bool { return changes[i][2:] < changes[j][2:] })
+	return changes, nil
+}
+
+// flattenKeys adds all leaf values of v to keys, using the path of nested
+// keys joined by dots as key.
+func flattenKeys(prefix string, v interface{}, keys map[string]string) {
+	join := func(key interface{}) string {
+		if prefix == "" {
+			return fmt.Sprint(key)
+		}
+		return fmt.Sprintf("%s.%v", prefix, key)
+	}
+
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		for key, value := range v {
+			flattenKeys(join(key), value, keys)
+		}
+	case map[string]interface{}:
+		for key, value := range v {
+			flattenKeys(join(key), value, keys)
+		}
+	case []interface{}:
+		for i, value := range v {
+			flattenKeys(fmt.Sprintf("%s[%d]", prefix, i), value, keys)
+		}
+	case nil:
+		if prefix != "" {
+			keys[prefix] = ""
+		}
+	default:
+		keys[prefix] = fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/phrase/phraseapp-go/phraseapp"
+)
+
+func TestKeyDiff(t *testing.T) {
+	local := []byte("en:\n  a: one\n  b:\n    c: two\n  d: gone\n")
+	remote := []byte("en:\n  a: one\n  b:\n    c: TWO\n  e: new\n")
+
+	changes, err := keyDiff(local, remote, "config/en.yml")
+	if err != nil {
+		t.Fatalf("didn't expect an error, got: %s", err)
+	}
+
+	exp := []string{
+		`~ en.b.c: "two" -> "TWO"`,
+		`- en.d: "gone"`,
+		`+ en.e: "new"`,
+	}
+	if !reflect.DeepEqual(changes, exp) {
+		t.Errorf("expected changes %q, got %q", exp, changes)
+	}
+
+	changes, err = keyDiff([]byte(`{"a": {"b": "x"}}`), []byte(`{"a": {"b": "x"}, "c": ["y"]}`), "en.json")
+	if err != nil {
+		t.Fatalf("didn't expect an error, got: %s", err)
+	}
+	if exp := []string{`+ c[0]: "y"`}; !reflect.DeepEqual(changes, exp) {
+		t.Errorf("expected changes %q, got %q", exp, changes)
+	}
+
+	changes, err = keyDiff([]byte("a"), []byte("b"), "en.strings")
+	if err != nil || changes != nil {
+		t.Errorf("expected unstructured formats to be ignored, got %q, %v", changes, err)
+	}
+}
+
+func TestDiffCommand(t *testing.T) {
+	d, err := ioutil.TempDir("", "phrase-diff-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(d)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		switch {
+		case strings.HasSuffix(req.URL.Path, "/locales"):
+			fmt.Fprint(resp, `[{"id": "en-locale-id", "code": "en", "name": "english"}, {"id": "de-locale-id", "code": "de", "name": "german"}]`)
+		case strings.Contains(req.URL.Path, "/en-locale-id/"):
+			fmt.Fprint(resp, "en:\n  a: one\n")
+		default:
+			fmt.Fprint(resp, "de:\n  a: eins\n")
+		}
+	}))
+	defer srv.Close()
+
+	if err := ioutil.WriteFile(filepath.Join(d, "en.yml"), []byte("en:\n  a: one\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := new(phraseapp.Config)
+	cfg.Credentials = phraseapp.Credentials{Host: srv.URL, Token: "some_token"}
+	cfg.DefaultProjectID = "project-id"
+	cfg.DefaultFileFormat = "yml"
+	cfg.Targets = []byte(fmt.Sprintf("targets:\n- file: %s\n", filepath.Join(d, "<locale_code>.yml")))
+
+	cmd := &DiffCommand{Config: *cfg, Context: 3}
+	err = cmd.Run()
+	if err == nil || !strings.Contains(err.Error(), "1 of 2 file(s) differ") {
+		t.Errorf("expected the missing de.yml to be reported as difference, got: %v", err)
+	} else if code := err.(*exitError).ExitCode(); code != diffExitDiffering {
+		t.Errorf("expected exit status %d for differences, got %d", diffExitDiffering, code)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(d, "de.yml"), []byte("de:\n  a: eins\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := cmd.Run(); err != nil {
+		t.Errorf("expected no differences, got: %s", err)
+	}
+
+	cmd.Context = -1
+	err = cmd.Run()
+	if e, ok := err.(*exitError); !ok || e.ExitCode() != diffExitTrouble || !strings.Contains(err.Error(), "--context must not be negative") {
+		t.Errorf("expected a negative context to fail with exit status %d, got: %v", diffExitTrouble, err)
+	}
+	cmd.Context = 3
+
+	// failures are told apart from differences by the exit status
+	srv.Close()
+	cmd.MaxRetries = new(int)
+	err = cmd.Run()
+	if e, ok := err.(*exitError); !ok || e.ExitCode() != diffExitTrouble {
+		t.Errorf("expected a failure with exit status %d, got: %v", diffExitTrouble, err)
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/phrase/phraseapp-go/phraseapp"
+)
+
+const downloadCacheFileName = ".phraseapp.cache"
+
+// downloadCache remembers the ETag and Last-Modified header of downloaded
+// locales, so that pull can send conditional requests and leave files alone
+// that didn't change in PhraseApp.
+type downloadCache struct {
+	path string
+	mu   sync.Mutex
+
+	Downloads map[string]*downloadRecord `json:"downloads"`
+}
+
+// downloadRecord describes the last download written to a locale file.
+type downloadRecord struct {
+	// identifies project, locale and download parameters
+	Request      string `json:"request"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+	// hash of the content written to the file
+	Hash string `json:"hash"`
+}
+
+// loadDownloadCache reads the cache file at path. A missing file results in
+// an empty cache.
+func loadDownloadCache(path string) (*downloadCache, error) {
+	cache := &downloadCache{path: path, Downloads: map[string]*downloadRecord{}}
+
+	content, err := ioutil.ReadFile(path)
+	switch {
+	case os.IsNotExist(err):
+		return cache, nil
+	case err != nil:
+		return nil, err
+	}
+
+	if err := json.Unmarshal(content, cache); err != nil {
+		return nil, err
+	}
+	if cache.Downloads == nil {
+		cache.Downloads = map[string]*downloadRecord{}
+	}
+	return cache, nil
+}
+
+func (cache *downloadCache) save() error {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	content, err := json.MarshalIndent(cache, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(cache.path, append(content, '\n'), 0644)
+}
+
+func (cache *downloadCache) key(localeFile *LocaleFile) string {
+	rel, err := filepath.Rel(filepath.Dir(cache.path), localeFile.Path)
+	if err != nil {
+		rel = localeFile.Path
+	}
+	return filepath.ToSlash(rel)
+}
+
+// lookup returns the record of the last download of the same request to the
+// locale file. Nothing is returned if the file was changed since, so that
+// local modifications get overwritten as usual.
+func (cache *downloadCache) lookup(localeFile *LocaleFile, request string) *downloadRecord {
+	cache.mu.Lock()
+	record, found := cache.Downloads[cache.key(localeFile)]
+	cache.mu.Unlock()
+
+	if !found || record.Request != request {
+		return nil
+	}
+
+	content, err := ioutil.ReadFile(localeFile.Path)
+	if err != nil || hashContent(content) != record.Hash {
+		return nil
+	}
+	return record
+}
+
+func (cache *downloadCache) store(localeFile *LocaleFile, record *downloadRecord) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	cache.Downloads[cache.key(localeFile)] = record
+}
+
+// downloadRequest identifies a download of a locale with the given params.
+func downloadRequest(projectID, localeID string, params *phraseapp.LocaleDownloadParams) (string, error) {
+	p, err := json.Marshal(params)
+	if err != nil {
+		return "", err
+	}
+	return projectID + "/" + localeID + "?" + hashContent(p), nil
+}
+
+func hashContent(content []byte) string {
+	h := sha256.Sum256(content)
+	return hex.EncodeToString(h[:])
+}
+
+// conditionalTransport adds the validators of a previous download to a
+// request. If the server responds with 304 Not Modified, an empty response
+// with status 200 is returned instead, as the client library would treat the
+// 304 as error, and notModified is set.
+type conditionalTransport struct {
+	base   http.RoundTripper
+	record *downloadRecord
+
+	notModified  bool
+	etag         string
+	lastModified string
+}
+
+func (t *conditionalTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.record != nil {
+		r := new(http.Request)
+		*r = *req
+		r.Header = http.Header{}
+		for k, v := range req.Header {
+			r.Header[k] = v
+		}
+		if t.record.ETag != "" {
+			r.Header.Set("If-None-Match", t.record.ETag)
+		}
+		if t.record.LastModified != "" {
+			r.Header.Set("If-Modified-Since", t.record.LastModified)
+		}
+		req = r
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		t.notModified = true
+		resp.StatusCode = http.StatusOK
+		resp.Status = "200 OK"
+	case http.StatusOK:
+		t.etag = resp.Header.Get("ETag")
+		t.lastModified = resp.Header.Get("Last-Modified")
+	}
+	return resp, nil
+}
+
+// withConditionalTransport returns a copy of client sending its requests
+// through a new conditionalTransport for the given record.
+func withConditionalTransport(client *phraseapp.Client, record *downloadRecord) (*phraseapp.Client, *conditionalTransport) {
+	base := client.Client.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	tr := &conditionalTransport{base: base, record: record}
+	c := new(phraseapp.Client)
+	*c = *client
+	c.Client.Transport = tr
+	return c, tr
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/phrase/phraseapp-go/phraseapp"
+)
+
+// Events reported per locale file by push and pull with JSON output.
+const (
+	eventUploaded   = "uploaded"
+	eventSkipped    = "skipped"
+	eventDownloaded = "downloaded"
+	eventUnchanged  = "unchanged"
+	eventUpToDate   = "up_to_date"
+	eventStale      = "stale"
+	eventFailed     = "failed"
+
+	// reported per project by push with the cleanup option
+	eventCleanedUp = "cleaned_up"
+)
+
+// fileEvent describes the result of handling a single locale file, or of
+// cleaning up a project. Events are written as one JSON object per line, so
+// scripts can process them as they arrive.
+type fileEvent struct {
+	Event       string                 `json:"event"`
+	Path        string                 `json:"path,omitempty"`
+	ProjectID   string                 `json:"project_id"`
+	LocaleID    string                 `json:"locale_id,omitempty"`
+	LocaleCode  string                 `json:"locale_code,omitempty"`
+	LocaleName  string                 `json:"locale_name,omitempty"`
+	Tag         string                 `json:"tag,omitempty"`
+	UploadID    string                 `json:"upload_id,omitempty"`
+	UploadState string                 `json:"upload_state,omitempty"`
+	Summary     *phraseapp.SummaryType `json:"summary,omitempty"`
+	DeletedKeys *int64                 `json:"deleted_keys,omitempty"`
+	Reason      string                 `json:"reason,omitempty"`
+	Error       string                 `json:"error,omitempty"`
+}
+
+func newFileEvent(event, projectID string, localeFile *LocaleFile) *fileEvent {
+	return &fileEvent{
+		Event:      event,
+		Path:       localeFile.RelPath(),
+		ProjectID:  projectID,
+		LocaleID:   localeFile.ID,
+		LocaleCode: localeFile.Code,
+		LocaleName: localeFile.Name,
+		Tag:        localeFile.Tag,
+	}
+}
+
+// withUpload adds the ID, state and summary of upload to the event.
+func (e *fileEvent) withUpload(upload *phraseapp.Upload) *fileEvent {
+	e.UploadID = upload.ID
+	e.UploadState = upload.State
+	summary := upload.Summary
+	e.Summary = &summary
+	return e
+}
+
+func (e *fileEvent) withError(err error) *fileEvent {
+	e.Event = eventFailed
+	e.Error = err.Error()
+	return e
+}
+
+// eventWriter writes events as newline delimited JSON.
+type eventWriter struct {
+	enc *json.Encoder
+}
+
+func newEventWriter(w io.Writer) *eventWriter {
+	return &eventWriter{enc: json.NewEncoder(w)}
+}
+
+func (w *eventWriter) write(e *fileEvent) error {
+	return w.enc.Encode(e)
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/phrase/phraseapp-go/phraseapp"
+)
+
+func decodeEvents(t *testing.T, buf *bytes.Buffer) []*fileEvent {
+	events := []*fileEvent{}
+	dec := json.NewDecoder(buf)
+	for dec.More() {
+		e := new(fileEvent)
+		if err := dec.Decode(e); err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, e)
+	}
+	return events
+}
+
+func TestPushEvents(t *testing.T) {
+	d := setupFiles(t, "en.yml", "de.yml")
+	defer os.RemoveAll(d)
+
+	defer func(dir string) { configDir = dir }(configDir)
+	configDir = d
+
+	srv := httptest.NewServer(new(uploadCounter))
+	defer srv.Close()
+
+	c, err := newClient(phraseapp.Credentials{Host: srv.URL, Token: "some_token"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	source := getBaseSource()
+	source.File = filepath.Join(d, "<locale_code>.yml")
+	source.Format = new(phraseapp.Format)
+
+	for _, exp := range []string{eventUploaded, eventSkipped} {
+		buf := new(bytes.Buffer)
+		cmd := &PushCommand{Output: outputJSON, events: newEventWriter(buf)}
+		if err := cmd.push(c, Sources{source}); err != nil {
+			t.Fatalf("didn't expect an error, got: %s", err)
+		}
+
+		events := decodeEvents(t, buf)
+		if len(events) != 2 {
+			t.Fatalf("expected 2 events, got %d", len(events))
+		}
+		e := events[1]
+		if e.Event != exp || e.LocaleID != "en-locale-id" || e.ProjectID != "project-id" || filepath.Base(e.Path) != "en.yml" {
+			t.Errorf("unexpected event: %+v", e)
+		}
+		if exp == eventUploaded && (e.UploadID != "upload-id" || e.UploadState != "success" || e.Summary == nil) {
+			t.Errorf("expected event to contain the upload, got %+v", e)
+		}
+		if exp == eventSkipped && e.Reason != "unchanged" {
+			t.Errorf("expected file to be skipped as unchanged, got %+v", e)
+		}
+	}
+}
+
+func TestPushEventsFailedLocaleCreation(t *testing.T) {
+	d := setupFiles(t, "fr.yml")
+	defer os.RemoveAll(d)
+
+	defer func(dir string) { configDir = dir }(configDir)
+	configDir = d
+
+	srv := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		if req.Method == "POST" && strings.HasSuffix(req.URL.Path, "/locales") {
+			resp.WriteHeader(http.StatusUnprocessableEntity)
+			fmt.Fprint(resp, `{"message": "Validation failed", "errors": [{"resource": "Locale", "field": "name", "message": "is invalid"}]}`)
+			return
+		}
+		resp.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(resp, `{"message": "Not Found"}`)
+	}))
+	defer srv.Close()
+
+	c, err := newClient(phraseapp.Credentials{Host: srv.URL, Token: "some_token"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	source := getBaseSource()
+	source.File = filepath.Join(d, "<locale_code>.yml")
+	source.Format = new(phraseapp.Format)
+
+	buf := new(bytes.Buffer)
+	cmd := &PushCommand{Output: outputJSON, events: newEventWriter(buf)}
+	cmd.MaxRetries = new(int)
+	if err := cmd.push(c, Sources{source}); err == nil || !strings.Contains(err.Error(), "failed to create locale") {
+		t.Errorf("expected locale creation to fail, got %v", err)
+	}
+
+	events := decodeEvents(t, buf)
+	if len(events) != 1 || events[0].Event != eventFailed || !strings.Contains(events[0].Error, "failed to create locale") {
+		t.Errorf("expected a failed event, got %+v", events)
+	}
+}
+
+func TestPullEvents(t *testing.T) {
+	d := setupFiles(t)
+	defer os.RemoveAll(d)
+
+	srv := httptest.NewServer(&downloadHandler{rateLimited: map[string]bool{"de-locale-id": true}})
+	defer srv.Close()
+
+	c, err := newClient(phraseapp.Credentials{Host: srv.URL, Token: "some_token"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	target := getBaseTarget()
+	target.File = filepath.Join(d, "<locale_code>.yml")
+	target.RemoteLocales = append(getBaseLocales(), &phraseapp.Locale{Code: "fr", ID: "fr-locale-id", Name: "french"})
+
+	buf := new(bytes.Buffer)
+	cmd := &PullCommand{NoCache: true, Output: outputJSON, events: newEventWriter(buf)}
+	if err := cmd.pull(c, Targets{target}); err == nil {
+		t.Fatalf("expected an error for the missing locale, got none")
+	}
+
+	events := decodeEvents(t, buf)
+	if len(events) != 3 {
+		t.Fatalf("expected 3 events, got %d", len(events))
+	}
+	for i, exp := range []string{eventDownloaded, eventDownloaded, eventFailed} {
+		if events[i].Event != exp {
+			t.Errorf("expected event %d to be %q, got %+v", i, exp, events[i])
+		}
+	}
+	if events[2].LocaleCode != "fr" || events[2].Error == "" {
+		t.Errorf("expected failure for the fr locale, got %+v", events[2])
+	}
+}
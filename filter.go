@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// localeFileFilter narrows the locale files handled by push and pull to the
+// ones given with the locale and tag options. Empty lists match everything.
+type localeFileFilter struct {
+	Locales []string
+	Tags    []string
+}
+
+// matches returns whether the locale file belongs to one of the locales and
+// one of the tags of the filter. Locales are matched by code, name or ID.
+// Besides the tag of the file, tags configured for its source or target can be
+// given.
+func (f *localeFileFilter) matches(localeFile *LocaleFile, tags ...string) bool {
+	if f == nil {
+		return true
+	}
+
+	if len(f.Locales) > 0 && !containsAny(f.Locales, localeFile.Code, localeFile.Name, localeFile.ID) {
+		return false
+	}
+
+	if len(f.Tags) > 0 && !containsAny(f.Tags, append(tags, localeFile.Tag)...) {
+		return false
+	}
+
+	return true
+}
+
+func containsAny(list []string, values ...string) bool {
+	for _, v := range values {
+		if v == "" {
+			continue
+		}
+		for _, item := range list {
+			if item == v {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// splitTags splits a comma separated list of tags.
+func splitTags(tags string) []string {
+	result := []string{}
+	for _, tag := range strings.Split(tags, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			result = append(result, tag)
+		}
+	}
+	return result
+}
+
+// selectEntries returns the indexes of the config entries given by
+// selectors. A selector is either the name of an entry or its position,
+// starting at 1. Without selectors all entries are returned.
+func selectEntries(kind string, selectors []string, names []string) ([]int, error) {
+	if len(selectors) == 0 {
+		indexes := make([]int, len(names))
+		for i := range names {
+			indexes[i] = i
+		}
+		return indexes, nil
+	}
+
+	selected := make([]bool, len(names))
+	for _, selector := range selectors {
+		found := false
+		for i, name := range names {
+			if name != "" && name == selector {
+				selected[i] = true
+				found = true
+			}
+		}
+
+		if !found {
+			pos, err := strconv.Atoi(selector)
+			if err != nil || pos < 1 || pos > len(names) {
+				return nil, fmt.Errorf("There is no %s named %q and it's not a position between 1 and %d either", kind, selector, len(names))
+			}
+			selected[pos-1] = true
+		}
+	}
+
+	indexes := []int{}
+	for i, ok := range selected {
+		if ok {
+			indexes = append(indexes, i)
+		}
+	}
+	return indexes, nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLocaleFileFilter(t *testing.T) {
+	lf := &LocaleFile{Code: "de", Name: "german", ID: "de-locale-id", Tag: "checkout"}
+
+	tt := []struct {
+		filter *localeFileFilter
+		tags   []string
+		exp    bool
+	}{
+		{nil, nil, true},
+		{&localeFileFilter{}, nil, true},
+		{&localeFileFilter{Locales: []string{"fr", "de"}}, nil, true},
+		{&localeFileFilter{Locales: []string{"german"}}, nil, true},
+		{&localeFileFilter{Locales: []string{"de-locale-id"}}, nil, true},
+		{&localeFileFilter{Locales: []string{"fr"}}, nil, false},
+		{&localeFileFilter{Tags: []string{"checkout"}}, nil, true},
+		{&localeFileFilter{Tags: []string{"cart"}}, nil, false},
+		{&localeFileFilter{Tags: []string{"cart"}}, []string{"web", "cart"}, true},
+		{&localeFileFilter{Locales: []string{"de"}, Tags: []string{"cart"}}, nil, false},
+	}
+
+	for i, tti := range tt {
+		if got := tti.filter.matches(lf, tti.tags...); got != tti.exp {
+			t.Errorf("%d: expected %t, got %t", i, tti.exp, got)
+		}
+	}
+}
+
+func TestSelectEntries(t *testing.T) {
+	names := []string{"web", "", "mobile"}
+
+	tt := []struct {
+		selectors []string
+		exp       []int
+		err       string
+	}{
+		{nil, []int{0, 1, 2}, ""},
+		{[]string{"mobile"}, []int{2}, ""},
+		{[]string{"2", "web"}, []int{0, 1}, ""},
+		{[]string{"4"}, nil, `no source named "4"`},
+		{[]string{"desktop"}, nil, `no source named "desktop"`},
+	}
+
+	for _, tti := range tt {
+		got, err := selectEntries("source", tti.selectors, names)
+		switch {
+		case tti.err != "" && (err == nil || !strings.Contains(err.Error(), tti.err)):
+			t.Errorf("%v: expected error %q, got %v", tti.selectors, tti.err, err)
+		case tti.err == "" && !reflect.DeepEqual(got, tti.exp):
+			t.Errorf("%v: expected %v, got %v (error %v)", tti.selectors, tti.exp, got, err)
+		}
+	}
+}
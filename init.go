@@ -390,7 +390,7 @@ func (cmd *InitCommand) writeConfig() error {
 }
 
 func firstPush() error {
-	cfg, err := phraseapp.ReadConfig()
+	cfg, _, err := readConfig(paths.YamlConfigName, "")
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
 		os.Exit(2)
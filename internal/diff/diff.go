@@ -0,0 +1,253 @@
+// Package diff computes line based differences between two texts and
+// formats them as unified diff.
+package diff
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+type opKind byte
+
+const (
+	opEqual  opKind = ' '
+	opDelete opKind = '-'
+	opInsert opKind = '+'
+)
+
+type op struct {
+	kind opKind
+	line string
+	// number of lines of a and b that precede this operation
+	aPos, bPos int
+}
+
+// Unified returns the differences between a and b in the unified diff format,
+// using nameA and nameB in the header and showing context unchanged lines
+// around every change. A negative context is treated as 0. An empty string is
+// returned if a and b are equal.
+func Unified(a, b []byte, nameA, nameB string, context int) string {
+	if bytes.Equal(a, b) {
+		return ""
+	}
+	if context < 0 {
+		context = 0
+	}
+
+	ops := lineOps(splitLines(a), splitLines(b))
+
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "--- %s\n+++ %s\n", nameA, nameB)
+	for _, h := range hunks(ops, context) {
+		writeHunk(buf, ops[h[0]:h[1]])
+	}
+	return buf.String()
+}
+
+// splitLines splits s into lines, keeping the line terminators so that a
+// missing newline at the end of s is detected as difference.
+func splitLines(s []byte) []string {
+	lines := strings.SplitAfter(string(s), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// lineOps computes the shortest edit script transforming a into b. Common
+// leading and trailing lines are split off first, as the edit script search
+// needs memory quadratic in the number of differences.
+func lineOps(a, b []string) []op {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	ops := []op{}
+	for _, line := range a[:prefix] {
+		ops = append(ops, op{kind: opEqual, line: line})
+	}
+
+	middleA, middleB := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+	switch {
+	case len(middleA) == 0:
+		// e.g. a missing file, only lines to insert
+		for _, line := range middleB {
+			ops = append(ops, op{kind: opInsert, line: line})
+		}
+	case len(middleB) == 0:
+		for _, line := range middleA {
+			ops = append(ops, op{kind: opDelete, line: line})
+		}
+	default:
+		ops = append(ops, shortestEdit(middleA, middleB)...)
+	}
+
+	for _, line := range a[len(a)-suffix:] {
+		ops = append(ops, op{kind: opEqual, line: line})
+	}
+
+	aPos, bPos := 0, 0
+	for i := range ops {
+		ops[i].aPos, ops[i].bPos = aPos, bPos
+		if ops[i].kind != opInsert {
+			aPos++
+		}
+		if ops[i].kind != opDelete {
+			bPos++
+		}
+	}
+	return ops
+}
+
+// shortestEdit computes the shortest edit script transforming a into b using
+// the algorithm described in "An O(ND) Difference Algorithm and Its
+// Variations" by Eugene W. Myers.
+func shortestEdit(a, b []string) []op {
+	n, m := len(a), len(b)
+	max := n + m
+	offset := max + 1
+	v := make([]int, 2*max+3)
+
+	// trace[d] holds the part of v that is read in step d.
+	trace := [][]int{}
+
+search:
+	for d := 0; d <= max; d++ {
+		trace = append(trace, append([]int(nil), v[offset-d-1:offset+d+2]...))
+
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x, y = x+1, y+1
+			}
+			v[offset+k] = x
+
+			if x >= n && y >= m {
+				break search
+			}
+		}
+	}
+
+	// walk back from the end to collect the operations in reverse order
+	ops := []op{}
+	x, y := n, m
+	for d := len(trace) - 1; d >= 0; d-- {
+		get := func(k int) int { return trace[d][k+d+1] }
+
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && get(k-1) < get(k+1)) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := get(prevK)
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			x, y = x-1, y-1
+			ops = append(ops, op{kind: opEqual, line: a[x]})
+		}
+
+		if d > 0 {
+			if x == prevX {
+				ops = append(ops, op{kind: opInsert, line: b[prevY]})
+			} else {
+				ops = append(ops, op{kind: opDelete, line: a[prevX]})
+			}
+		}
+		x, y = prevX, prevY
+	}
+
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+	return ops
+}
+
+// hunks returns the [start, end) ranges of ops that make up the hunks of a
+// unified diff. Changes closer than 2*context lines are merged into one hunk.
+func hunks(ops []op, context int) [][2]int {
+	result := [][2]int{}
+	for i := 0; i < len(ops); i++ {
+		if ops[i].kind == opEqual {
+			continue
+		}
+
+		start := i - context
+		if start < 0 {
+			start = 0
+		}
+
+		// find the end of the changes, tolerating short runs of equal lines
+		end := i
+		for end < len(ops) {
+			if ops[end].kind != opEqual {
+				end++
+				continue
+			}
+			run := end
+			for run < len(ops) && ops[run].kind == opEqual {
+				run++
+			}
+			if run == len(ops) || run-end > 2*context {
+				break
+			}
+			end = run
+		}
+
+		stop := end + context
+		if stop > len(ops) {
+			stop = len(ops)
+		}
+
+		result = append(result, [2]int{start, stop})
+		i = stop - 1
+	}
+	return result
+}
+
+func writeHunk(buf *bytes.Buffer, ops []op) {
+	aLen, bLen := 0, 0
+	for _, o := range ops {
+		if o.kind != opInsert {
+			aLen++
+		}
+		if o.kind != opDelete {
+			bLen++
+		}
+	}
+
+	fmt.Fprintf(buf, "@@ -%s +%s @@\n", hunkRange(ops[0].aPos, aLen), hunkRange(ops[0].bPos, bLen))
+	for _, o := range ops {
+		buf.WriteByte(byte(o.kind))
+		buf.WriteString(o.line)
+		if !strings.HasSuffix(o.line, "\n") {
+			buf.WriteString("\n\\ No newline at end of file\n")
+		}
+	}
+}
+
+func hunkRange(pos, length int) string {
+	switch length {
+	case 0:
+		return fmt.Sprintf("%d,0", pos)
+	case 1:
+		return fmt.Sprintf("%d", pos+1)
+	default:
+		return fmt.Sprintf("%d,%d", pos+1, length)
+	}
+}
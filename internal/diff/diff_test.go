@@ -0,0 +1,136 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestUnified(t *testing.T) {
+	tt := []struct {
+		name string
+		a, b string
+		exp  string
+	}{
+		{"equal", "a\nb\n", "a\nb\n", ""},
+		{"change", "a\nb\nc\n", "a\nx\nc\n", `--- a
++++ b
+@@ -1,3 +1,3 @@
+ a
+-b
++x
+ c
+`},
+		{"insert into empty", "", "a\n", `--- a
++++ b
+@@ -0,0 +1 @@
++a
+`},
+		{"delete all", "a\nb\n", "", `--- a
++++ b
+@@ -1,2 +0,0 @@
+-a
+-b
+`},
+		{"missing newline", "a\nb", "a\nb\n", `--- a
++++ b
+@@ -1,2 +1,2 @@
+ a
+-b
+\ No newline at end of file
++b
+`},
+		{"separate hunks", "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n", "x\n2\n3\n4\n5\n6\n7\n8\n9\ny\n", `--- a
++++ b
+@@ -1,2 +1,2 @@
+-1
++x
+ 2
+@@ -9,2 +9,2 @@
+ 9
+-10
++y
+`},
+		{"merged hunks", "1\n2\n3\n4\n", "x\n2\n3\ny\n", `--- a
++++ b
+@@ -1,4 +1,4 @@
+-1
++x
+ 2
+ 3
+-4
++y
+`},
+	}
+
+	for _, tti := range tt {
+		got := Unified([]byte(tti.a), []byte(tti.b), "a", "b", 1)
+		if got != tti.exp {
+			t.Errorf("%s: expected\n%s\ngot\n%s", tti.name, tti.exp, got)
+		}
+	}
+
+	// a negative context is treated as no context at all
+	a, b := []byte("1\n2\n3\n"), []byte("1\nx\n3\n")
+	if got, exp := Unified(a, b, "a", "b", -1), Unified(a, b, "a", "b", 0); got != exp {
+		t.Errorf("expected negative context to result in\n%s\ngot\n%s", exp, got)
+	}
+}
+
+func TestLineOpsRoundTrip(t *testing.T) {
+	a := splitLines([]byte("a\nb\nc\na\nb\nb\na\n"))
+	b := splitLines([]byte("c\nb\na\nb\na\nc\n"))
+
+	ops := lineOps(a, b)
+
+	var gotA, gotB []string
+	changes := 0
+	for _, o := range ops {
+		if o.kind != opInsert {
+			gotA = append(gotA, o.line)
+		}
+		if o.kind != opDelete {
+			gotB = append(gotB, o.line)
+		}
+		if o.kind != opEqual {
+			changes++
+		}
+	}
+
+	if strings.Join(gotA, "") != strings.Join(a, "") || strings.Join(gotB, "") != strings.Join(b, "") {
+		t.Errorf("operations don't reproduce the inputs: %v", ops)
+	}
+	// the example from the Myers paper has an edit distance of 5
+	if changes != 5 {
+		t.Errorf("expected 5 changes, got %d", changes)
+	}
+}
+
+func TestLineOpsLargeFiles(t *testing.T) {
+	lines := make([]string, 20000)
+	for i := range lines {
+		lines[i] = fmt.Sprintf("key_%d: value %d\n", i, i)
+	}
+	changed := append([]string{}, lines...)
+	changed[10000] = "key_10000: changed\n"
+
+	for _, tc := range []struct {
+		name    string
+		a, b    []string
+		changes int
+	}{
+		{"missing file", nil, lines, len(lines)},
+		{"removed file", lines, nil, len(lines)},
+		{"single change", lines, changed, 2},
+	} {
+		changes := 0
+		for _, o := range lineOps(tc.a, tc.b) {
+			if o.kind != opEqual {
+				changes++
+			}
+		}
+		if changes != tc.changes {
+			t.Errorf("%s: expected %d changes, got %d", tc.name, tc.changes, changes)
+		}
+	}
+}
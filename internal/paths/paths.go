@@ -6,6 +6,7 @@ import (
 	"path/filepath"
 	"strings"
 
+	"github.com/phrase/phraseapp-client/internal/placeholders"
 	"github.com/phrase/phraseapp-client/internal/shared"
 )
 
@@ -22,7 +23,7 @@ func Validate(file, formatName, formatExtension string) error {
 		return fmt.Errorf("%q has no file extension", file)
 	}
 
-	if fileExtension == "<locale_code>" {
+	if placeholders.ContainsAnyPlaceholders(fileExtension) {
 		return nil
 	}
 
@@ -0,0 +1,88 @@
+package paths
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// WriteFileAtomically writes content to a temporary file in the directory of
+// path and renames it to path afterwards, so that path never contains partial
+// content. If mode is 0 an existing file keeps its permissions and a new file
+// is created with permissions according to the umask. Otherwise the file gets
+// exactly the permissions given by mode.
+func WriteFileAtomically(path string, content []byte, mode os.FileMode) error {
+	if mode == 0 {
+		if fi, err := os.Stat(path); err == nil {
+			mode = fi.Mode().Perm()
+		}
+	}
+
+	tmp, err := createTempFile(path)
+	if err != nil {
+		return err
+	}
+
+	err = writeAndClose(tmp, content, mode)
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
+
+// createTempFile creates a new hidden file next to path. It's created with
+// mode 0666, so that the umask applies just like for a regular new file.
+func createTempFile(path string) (*os.File, error) {
+	dir, base := filepath.Split(path)
+	for i := 0; i < 10; i++ {
+		name := filepath.Join(dir, fmt.Sprintf(".%s.%d%d.tmp", base, os.Getpid(), time.Now().UnixNano()))
+		f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+		if os.IsExist(err) {
+			continue
+		}
+		return f, err
+	}
+	return nil, fmt.Errorf("could not create temporary file for %s", path)
+}
+
+func writeAndClose(f *os.File, content []byte, mode os.FileMode) error {
+	_, err := f.Write(content)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && mode != 0 {
+		err = os.Chmod(f.Name(), mode)
+	}
+	return err
+}
+
+// CreateDir creates the directory dir including all missing parents. If mode
+// is 0 the directories are created with permissions according to the umask.
+// Otherwise dir gets exactly the permissions given by mode.
+func CreateDir(dir string, mode os.FileMode) error {
+	if IsDir(dir) {
+		return nil
+	}
+
+	perm := mode
+	if perm == 0 {
+		perm = 0777
+	}
+
+	if err := os.MkdirAll(dir, perm); err != nil {
+		return err
+	}
+
+	if mode != 0 {
+		return os.Chmod(dir, mode)
+	}
+	return nil
+}
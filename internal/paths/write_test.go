@@ -0,0 +1,81 @@
+package paths
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteFileAtomically(t *testing.T) {
+	d, err := ioutil.TempDir("", "write")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(d)
+
+	path := filepath.Join(d, "en.yml")
+	if err := ioutil.WriteFile(path, []byte("old"), 0640); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(path, 0640); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := WriteFileAtomically(path, []byte("new"), 0); err != nil {
+		t.Fatal(err)
+	}
+	assertFile(t, path, "new", 0640)
+
+	if err := WriteFileAtomically(path, []byte("newer"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	assertFile(t, path, "newer", 0600)
+
+	files, err := ioutil.ReadDir(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Errorf("expected temporary files to be removed, found %d files", len(files))
+	}
+}
+
+func TestCreateDir(t *testing.T) {
+	d, err := ioutil.TempDir("", "write")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(d)
+
+	dir := filepath.Join(d, "a", "b")
+	if err := CreateDir(dir, 0750); err != nil {
+		t.Fatal(err)
+	}
+
+	fi, err := os.Stat(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0750 {
+		t.Errorf("expected mode %#o, got %#o", 0750, fi.Mode().Perm())
+	}
+}
+
+func assertFile(t *testing.T, path, content string, mode os.FileMode) {
+	got, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != content {
+		t.Errorf("expected content %q, got %q", content, got)
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != mode {
+		t.Errorf("expected mode %#o, got %#o", mode, fi.Mode().Perm())
+	}
+}
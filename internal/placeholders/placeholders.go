@@ -9,12 +9,54 @@ import (
 	"github.com/phrase/phraseapp-client/internal/stringz"
 )
 
+// A placeholder can be followed by transforms applied to its value in order,
+// e.g. <locale_code|underscore|lower> turns en-US into en_us.
+const transforms = `(\|(lower|underscore|language))*`
+
 var (
-	anyPlaceholderRegexp = regexp.MustCompile("<(locale_name|tag|locale_code)>")
-	localePlaceholder    = regexp.MustCompile("<(locale_name|locale_code)>")
-	tagPlaceholder       = regexp.MustCompile("<(tag)>")
+	anyPlaceholderRegexp = regexp.MustCompile("<(locale_name|tag|locale_code|locale_id|project_id)" + transforms + ">")
+	localePlaceholder    = regexp.MustCompile("<(locale_name|locale_code|locale_id)" + transforms + ">")
+	tagPlaceholder       = regexp.MustCompile("<(tag)" + transforms + ">")
 )
 
+// Parse splits a placeholder, with or without angle brackets, into its name
+// and transforms.
+func Parse(placeholder string) (name string, transforms []string) {
+	parts := strings.Split(strings.Trim(placeholder, "<>"), "|")
+	return parts[0], parts[1:]
+}
+
+// Transform applies the transforms to value in order. For en-US, lower returns
+// en-us, underscore returns en_US and language returns en.
+func Transform(value string, transforms ...string) string {
+	for _, transform := range transforms {
+		switch transform {
+		case "lower":
+			value = strings.ToLower(value)
+		case "underscore":
+			value = strings.Replace(value, "-", "_", -1)
+		case "language":
+			if i := strings.IndexAny(value, "-_"); i > 0 {
+				value = value[:i]
+			}
+		}
+	}
+	return value
+}
+
+// Replace substitutes all placeholders in s by the value given for their
+// name, with their transforms applied. Placeholders without a value are kept.
+func Replace(s string, values map[string]string) string {
+	return anyPlaceholderRegexp.ReplaceAllStringFunc(s, func(placeholder string) string {
+		name, transforms := Parse(placeholder)
+		value, ok := values[name]
+		if !ok {
+			return placeholder
+		}
+		return Transform(value, transforms...)
+	})
+}
+
 func ContainsAnyPlaceholders(s string) bool {
 	return anyPlaceholderRegexp.MatchString(s)
 }
@@ -38,7 +80,8 @@ func ToGlobbingPattern(s string) string {
 }
 
 // Resolve matches s against pattern and maps placeholders in pattern to
-// substrings of s.
+// substrings of s. Placeholders with transforms are returned with them, like
+// "locale_code|lower", as their original value can't be restored.
 // Resolve handles '*' wildcards in the pattern, but will return an error
 // if the pattern contains '**'.
 func Resolve(s, pattern string) (map[string]string, error) {
@@ -57,9 +100,15 @@ func Resolve(s, pattern string) (map[string]string, error) {
 	patternRE := regexp.QuoteMeta(pattern)
 	patternRE = strings.Replace(patternRE, "\\*", ".*", -1)
 
+	// subexpression names can't contain '|', so they are mapped back
+	groupNames := map[string]string{}
 	for _, placeholder := range stringz.RemoveDuplicates(placeholders) {
+		name := strings.Trim(placeholder, "<>")
+		groupName := strings.Replace(name, "|", "__", -1)
+		groupNames[groupName] = name
+
 		placeholder = regexp.QuoteMeta(placeholder)
-		placeholderRE := fmt.Sprintf("(?P%s[^/]+)", placeholder) // build named subexpression (capturing group) from placeholder
+		placeholderRE := fmt.Sprintf("(?P<%s>[^/]+)", groupName) // build named subexpression (capturing group) from placeholder
 		patternRE = strings.Replace(patternRE, placeholder, placeholderRE, -1)
 	}
 
@@ -80,7 +129,7 @@ func Resolve(s, pattern string) (map[string]string, error) {
 
 	values := map[string]string{}
 	for i, match := range matches {
-		placeholder := matchNames[i]
+		placeholder := groupNames[matchNames[i]]
 		if value, ok := values[placeholder]; ok {
 			if match != value {
 				return nil, fmt.Errorf("string %q does not match pattern %q: placeholder %q is used twice with different values", s, patternRE, placeholder)
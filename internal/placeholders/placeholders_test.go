@@ -62,6 +62,21 @@ func TestResolve(t *testing.T) {
 			"locale_code": "en",
 			"tag":         "abc",
 		},
+		{
+			"config/en_us/en.yml",
+			"config/<locale_code|underscore|lower>/<locale_code|language>.yml",
+		}: {
+			"locale_code|underscore|lower": "en_us",
+			"locale_code|language":         "en",
+		},
+		{
+			"project-id/abc/en-locale-id.yml",
+			"<project_id>/<tag>/<locale_id>.yml",
+		}: {
+			"project_id": "project-id",
+			"tag":        "abc",
+			"locale_id":  "en-locale-id",
+		},
 	}
 
 	for input, expected := range tests {
@@ -90,6 +105,9 @@ func TestToGlobbing(t *testing.T) {
 		}, {
 			path:    "abc/defg/*.lproj/Localizable.strings",
 			pattern: "abc/defg/<locale_code>.lproj/Localizable.strings",
+		}, {
+			path:    "*/*/*-*.json",
+			pattern: "<project_id>/<locale_code|lower>/<tag>-<locale_id>.json",
 		},
 	}
 	for _, test := range tests {
@@ -127,6 +145,29 @@ func TestResolve_errorPlaceholderReuse(t *testing.T) {
 	}
 }
 
+func TestReplace(t *testing.T) {
+	values := map[string]string{
+		"locale_code": "zh-Hant-TW",
+		"locale_name": "Chinese",
+		"tag":         "web",
+	}
+
+	tests := map[string]string{
+		"<locale_code>/<tag>.yml":                          "zh-Hant-TW/web.yml",
+		"<locale_code|lower>.yml":                          "zh-hant-tw.yml",
+		"<locale_code|underscore>.yml":                     "zh_Hant_TW.yml",
+		"<locale_code|language>.yml":                       "zh.yml",
+		"<locale_code|underscore|lower>/<locale_name>.yml": "zh_hant_tw/Chinese.yml",
+		"<locale_id>/<locale_name|lower>.yml":              "<locale_id>/chinese.yml",
+	}
+
+	for pattern, expected := range tests {
+		if result := Replace(pattern, values); result != expected {
+			t.Errorf("expected %q to be replaced by %q, but got %q", pattern, expected, result)
+		}
+	}
+}
+
 func areEqual(got, want map[string]string) bool {
 	for kw, vw := range want {
 		vg, ok := got[kw]
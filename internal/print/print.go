@@ -48,6 +48,11 @@ const parrot = `
 
 `
 
+// NoColor disables colored output. The escape codes changing the color are
+// always written to stdout, so they would end up in machine readable output,
+// even when the message itself is printed to stderr.
+var NoColor bool
+
 func Parrot() {
 	WithColor(ct.Cyan, parrot)
 }
@@ -69,8 +74,40 @@ func Error(err error) {
 }
 
 func fprintWithColor(w io.Writer, color ct.Color, msg string, args ...interface{}) {
+	if NoColor {
+		fmt.Fprintf(w, msg, args...)
+		fmt.Fprintln(w)
+		return
+	}
 	ct.Foreground(color, true)
 	fmt.Fprintf(w, msg, args...)
 	fmt.Fprintln(w)
 	ct.ResetColor()
 }
+
+// Buffer records messages so they can be printed later on as one coherent
+// block, which keeps the output of concurrently running tasks from
+// interleaving. If Direct is set messages are printed right away instead.
+type Buffer struct {
+	Direct bool
+
+	entries []string
+}
+
+// Printf records msg formatted with args without a trailing newline.
+func (b *Buffer) Printf(msg string, args ...interface{}) {
+	s := fmt.Sprintf(msg, args...)
+	if b.Direct {
+		fmt.Fprint(os.Stdout, s)
+		return
+	}
+	b.entries = append(b.entries, s)
+}
+
+// Flush prints all recorded messages to stdout and empties the buffer.
+func (b *Buffer) Flush() {
+	for _, s := range b.entries {
+		fmt.Fprint(os.Stdout, s)
+	}
+	b.entries = nil
+}
@@ -0,0 +1,77 @@
+package progress
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// Display shows the state of several tasks, one line per task. On a terminal
+// all lines are redrawn in place whenever a state changes, otherwise every
+// change is printed as a new line.
+type Display struct {
+	w    io.Writer
+	live bool
+
+	mu     sync.Mutex
+	labels []string
+	states []string
+	drawn  int
+}
+
+// New returns a display for tasks with the given labels writing to w.
+func New(w io.Writer, labels []string) *Display {
+	d := &Display{
+		w:      w,
+		live:   isTerminal(w),
+		labels: labels,
+		states: make([]string, len(labels)),
+	}
+	for i := range d.states {
+		d.states[i] = "waiting"
+	}
+	if d.live {
+		d.draw()
+	}
+	return d
+}
+
+// Set changes the state of the task with index i. Setting the current state
+// again is ignored.
+func (d *Display) Set(i int, state string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.states[i] == state {
+		return
+	}
+	d.states[i] = state
+
+	if d.live {
+		d.draw()
+	} else {
+		fmt.Fprintf(d.w, "%s: %s\n", d.labels[i], state)
+	}
+}
+
+// draw moves the cursor back to the first line of the display and prints all
+// lines again.
+func (d *Display) draw() {
+	if d.drawn > 0 {
+		fmt.Fprintf(d.w, "\033[%dA", d.drawn)
+	}
+	for i, label := range d.labels {
+		fmt.Fprintf(d.w, "\033[2K%s: %s\n", label, d.states[i])
+	}
+	d.drawn = len(d.labels)
+}
+
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
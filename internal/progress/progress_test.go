@@ -0,0 +1,19 @@
+package progress
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDisplayNotTerminal(t *testing.T) {
+	buf := new(bytes.Buffer)
+	d := New(buf, []string{"en.yml", "de.yml"})
+	d.Set(1, "processing")
+	d.Set(1, "processing")
+	d.Set(0, "success")
+
+	exp := "de.yml: processing\nen.yml: success\n"
+	if buf.String() != exp {
+		t.Errorf("expected %q, got %q", exp, buf.String())
+	}
+}
@@ -12,6 +12,10 @@ type LocaleFiles []*LocaleFile
 type LocaleFile struct {
 	Path, Name, ID, Code, Tag, FileFormat string
 	ExistsRemote                          bool
+
+	// values of placeholders with transforms found in the path on push, by
+	// placeholder like "locale_code|lower"
+	transformed map[string]string
 }
 
 func (localeFile *LocaleFile) RelPath() string {
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/phrase/phraseapp-go/phraseapp"
+)
+
+// LocaleMapping maps codes or names of remote locales to the tokens used for
+// them in local file paths, e.g. pt-BR to pt-rBR for Android resources.
+// Locales without an entry use their code or name as is.
+type LocaleMapping map[string]string
+
+func parseLocaleMapping(key string, raw map[string]interface{}) (LocaleMapping, error) {
+	if raw == nil {
+		return nil, nil
+	}
+
+	mapping, err := phraseapp.ConvertToStringMap(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", key, err)
+	}
+	return LocaleMapping(mapping), nil
+}
+
+// merge returns the entries of both mappings, preferring the ones of other.
+func (mapping LocaleMapping) merge(other LocaleMapping) LocaleMapping {
+	if len(mapping) == 0 {
+		return other
+	}
+
+	merged := LocaleMapping{}
+	for remote, local := range mapping {
+		merged[remote] = local
+	}
+	for remote, local := range other {
+		merged[remote] = local
+	}
+	return merged
+}
+
+// validate makes sure no two remote locales are mapped to the same token, as
+// files couldn't be mapped back on push otherwise.
+func (mapping LocaleMapping) validate() error {
+	remotes := make([]string, 0, len(mapping))
+	for remote := range mapping {
+		remotes = append(remotes, remote)
+	}
+	sort.Strings(remotes)
+
+	seen := map[string]string{}
+	for _, remote := range remotes {
+		local := mapping[remote]
+		if other, ok := seen[local]; ok {
+			return fmt.Errorf("locale_mapping maps both %q and %q to %q", other, remote, local)
+		}
+		seen[local] = remote
+	}
+	return nil
+}
+
+// local returns the token used in file paths for the remote code or name.
+func (mapping LocaleMapping) local(remote string) string {
+	if local, ok := mapping[remote]; ok {
+		return local
+	}
+	return remote
+}
+
+// remote returns the remote code or name for a token found in a file path.
+func (mapping LocaleMapping) remote(local string) string {
+	if local == "" {
+		return local
+	}
+	for remote, l := range mapping {
+		if l == local {
+			return remote
+		}
+	}
+	return local
+}
@@ -5,6 +5,7 @@ import (
 	"os"
 	"path/filepath"
 	"runtime/debug"
+	"strings"
 
 	bserrors "github.com/bugsnag/bugsnag-go/errors"
 	"github.com/dynport/dgtk/cli"
@@ -42,13 +43,45 @@ func Run() {
 	}()
 
 	phraseapp.ClientVersion = PHRASEAPP_CLIENT_VERSION
-	updateChecker.Check()
 
-	cfg, err := phraseapp.ReadConfig()
+	// stdout must contain nothing but JSON with JSON output
+	if containsJSONOutputFlag(os.Args[1:]) {
+		print.NoColor = true
+	} else {
+		updateChecker.Check()
+	}
+
+	args, configFlag, err := extractGlobalOption(os.Args[1:], "config")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		os.Exit(2)
+	}
+
+	args, profile, err := extractGlobalOption(args, "profile")
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
 		os.Exit(2)
 	}
+	if profile == "" {
+		profile = os.Getenv("PHRASEAPP_PROFILE")
+	}
+
+	cfg, configPath, err := readConfig(configFlag, profile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		os.Exit(2)
+	}
+
+	if cfg.Debug || containsVerboseFlag(args) {
+		if configPath != "" {
+			fmt.Fprintf(os.Stderr, "Using config file %s\n", configPath)
+		} else {
+			fmt.Fprintln(os.Stderr, "No config file found")
+		}
+		if profile != "" {
+			fmt.Fprintf(os.Stderr, "Using profile %s\n", profile)
+		}
+	}
 
 	r, err := router(cfg)
 	if err != nil {
@@ -56,13 +89,122 @@ func Run() {
 		os.Exit(3)
 	}
 
-	switch err := r.RunWithArgs(); err {
+	switch err := r.Run(joinRepeatedOptions(args)...); err {
 	case cli.ErrorHelpRequested, cli.ErrorNoRoute:
 		os.Exit(1)
 	case nil:
 		os.Exit(0)
 	default:
 		print.Error(err)
+		if coded, ok := err.(interface {
+			ExitCode() int
+		}); ok {
+			os.Exit(coded.ExitCode())
+		}
 		os.Exit(1)
 	}
 }
+
+// extractGlobalOption removes the global option with the given name, like
+// --config, from args and returns its value. Global options are handled here,
+// as they are needed to read the config before setting up the router.
+func extractGlobalOption(args []string, name string) ([]string, string, error) {
+	flag := "--" + name
+	remaining := []string{}
+	value := ""
+	for i := 0; i < len(args); i++ {
+		switch arg := args[i]; {
+		case arg == "--":
+			return append(remaining, args[i:]...), value, nil
+		case arg == flag:
+			if i+1 >= len(args) {
+				return nil, "", fmt.Errorf("%s requires a value", flag)
+			}
+			i++
+			value = args[i]
+		case strings.HasPrefix(arg, flag+"="):
+			value = strings.TrimPrefix(arg, flag+"=")
+		default:
+			remaining = append(remaining, arg)
+		}
+	}
+	return remaining, value, nil
+}
+
+// repeatableOptions are the options of a command that may be given several
+// times. The CLI library only keeps the last value of an option, so all values
+// are joined into a single comma separated one instead.
+var repeatableOptions = map[string][]string{
+	"push": {"locale", "tag", "source"},
+	"pull": {"locale", "tag", "target"},
+}
+
+func joinRepeatedOptions(args []string) []string {
+	if len(args) == 0 {
+		return args
+	}
+	for _, name := range repeatableOptions[args[0]] {
+		args = joinRepeatedOption(args, name)
+	}
+	return args
+}
+
+// joinRepeatedOption replaces all occurrences of the option with the given
+// name by a single one, at the position of the first, with all values.
+func joinRepeatedOption(args []string, name string) []string {
+	flag := "--" + name
+	remaining := []string{}
+	values := []string{}
+	first := -1
+loop:
+	for i := 0; i < len(args); i++ {
+		var value string
+		switch arg := args[i]; {
+		case arg == "--":
+			remaining = append(remaining, args[i:]...)
+			break loop
+		case arg == flag && i+1 < len(args):
+			i++
+			value = args[i]
+		case strings.HasPrefix(arg, flag+"="):
+			value = strings.TrimPrefix(arg, flag+"=")
+		default:
+			remaining = append(remaining, arg)
+			continue
+		}
+
+		if first < 0 {
+			first = len(remaining)
+			remaining = append(remaining, flag, "")
+		}
+		values = append(values, value)
+	}
+
+	if first >= 0 {
+		remaining[first+1] = strings.Join(values, ",")
+	}
+	return remaining
+}
+
+func containsVerboseFlag(args []string) bool {
+	for _, arg := range args {
+		if arg == "--verbose" || arg == "-v" {
+			return true
+		}
+	}
+	return false
+}
+
+func containsJSONOutputFlag(args []string) bool {
+	for i, arg := range args {
+		switch {
+		case arg == "--":
+			return false
+		case arg == "--output=json":
+			return true
+		case arg == "--output" && i+1 < len(args) && args[i+1] == "json":
+			return true
+		}
+	}
+	return false
+}
@@ -5,9 +5,13 @@ import (
 	"bytes"
 	"fmt"
 	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"sort"
 	"strings"
+	"sync"
 	"testing"
 
 	"github.com/dynport/dgtk/cli"
@@ -320,3 +324,110 @@ func TestCLIHelp_FormatOptions(t *testing.T) {
 	// FormatOptions are ignored with regard to defaults!
 	matchDefaultExpectations(t, defaults, map[string]string{})
 }
+
+func TestExtractGlobalOption(t *testing.T) {
+	for _, tc := range []struct {
+		args, remaining []string
+		path            string
+	}{
+		{[]string{"pull", "--verbose"}, []string{"pull", "--verbose"}, ""},
+		{[]string{"--config", "a.yml", "pull"}, []string{"pull"}, "a.yml"},
+		{[]string{"push", "--wait", "--config=b.yml"}, []string{"push", "--wait"}, "b.yml"},
+		{[]string{"key/create", "--", "--config", "c.yml"}, []string{"key/create", "--", "--config", "c.yml"}, ""},
+	} {
+		remaining, path, err := extractGlobalOption(tc.args, "config")
+		if err != nil {
+			t.Errorf("%v: unexpected error %s", tc.args, err)
+			continue
+		}
+		if strings.Join(remaining, " ") != strings.Join(tc.remaining, " ") || path != tc.path {
+			t.Errorf("%v: expected %v and %q, got %v and %q", tc.args, tc.remaining, tc.path, remaining, path)
+		}
+	}
+
+	if _, _, err := extractGlobalOption([]string{"pull", "--config"}, "config"); err == nil {
+		t.Errorf("expected --config without path to fail")
+	}
+
+	remaining, profile, err := extractGlobalOption([]string{"--profile", "staging", "pull", "--config=a.yml"}, "profile")
+	if err != nil || profile != "staging" || strings.Join(remaining, " ") != "pull --config=a.yml" {
+		t.Errorf("expected profile staging to be extracted, got %q and %v (%v)", profile, remaining, err)
+	}
+}
+
+func TestContainsJSONOutputFlag(t *testing.T) {
+	for _, tc := range []struct {
+		args []string
+		json bool
+	}{
+		{[]string{"push"}, false},
+		{[]string{"push", "--output", "text"}, false},
+		{[]string{"push", "--output", "json"}, true},
+		{[]string{"pull", "--verbose", "--output=json"}, true},
+		{[]string{"key/create", "--", "--output", "json"}, false},
+	} {
+		if json := containsJSONOutputFlag(tc.args); json != tc.json {
+			t.Errorf("%v: expected %t, got %t", tc.args, tc.json, json)
+		}
+	}
+}
+
+func TestJoinRepeatedOptions(t *testing.T) {
+	for _, tc := range []struct {
+		args, exp []string
+	}{
+		{[]string{"pull", "--locale", "de"}, []string{"pull", "--locale", "de"}},
+		{[]string{"pull", "--locale", "de", "--verbose", "--locale=fr,it"}, []string{"pull", "--locale", "de,fr,it", "--verbose"}},
+		{[]string{"push", "--tag", "a", "--source", "1", "--tag", "b"}, []string{"push", "--tag", "a,b", "--source", "1"}},
+		{[]string{"pull", "--locale"}, []string{"pull", "--locale"}},
+		{[]string{"key/create", "--tags", "a", "--tags", "b"}, []string{"key/create", "--tags", "a", "--tags", "b"}},
+		{[]string{"push", "--locale", "de", "--", "--locale", "fr"}, []string{"push", "--locale", "de", "--", "--locale", "fr"}},
+	} {
+		if got := joinRepeatedOptions(tc.args); strings.Join(got, " ") != strings.Join(tc.exp, " ") {
+			t.Errorf("%v: expected %v, got %v", tc.args, tc.exp, got)
+		}
+	}
+}
+
+func TestPullRepeatedLocaleOption(t *testing.T) {
+	d := setupFiles(t)
+	defer os.RemoveAll(d)
+
+	defer func(dir string) { configDir = dir }(configDir)
+	configDir = d
+
+	var mu sync.Mutex
+	downloaded := []string{}
+	srv := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		if strings.HasSuffix(req.URL.Path, "/locales") {
+			fmt.Fprint(resp, `[{"id": "en-locale-id", "code": "en"}, {"id": "de-locale-id", "code": "de"}, {"id": "fr-locale-id", "code": "fr"}]`)
+			return
+		}
+		localeID := strings.Split(req.URL.Path, "/")[5]
+		mu.Lock()
+		downloaded = append(downloaded, localeID)
+		mu.Unlock()
+		fmt.Fprintf(resp, "content of %s", localeID)
+	}))
+	defer srv.Close()
+
+	cfg := new(phraseapp.Config)
+	cfg.Credentials = phraseapp.Credentials{Host: srv.URL, Token: "some_token"}
+	cfg.DefaultProjectID = "project-id"
+	cfg.DefaultFileFormat = "yml"
+	cfg.Targets = []byte(fmt.Sprintf("targets:\n- file: %s\n", filepath.Join(d, "<locale_code>.yml")))
+
+	r, err := router(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	args := []string{"pull", "--locale", "de", "--no-cache", "--locale", "fr", "--output", "json"}
+	if err := r.Run(joinRepeatedOptions(args)...); err != nil {
+		t.Fatalf("didn't expect an error, got: %s", err)
+	}
+
+	sort.Strings(downloaded)
+	if strings.Join(downloaded, ",") != "de-locale-id,fr-locale-id" {
+		t.Errorf("expected all given locales to be pulled, got %v", downloaded)
+	}
+}
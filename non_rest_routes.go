@@ -10,9 +10,13 @@ func ApplyNonRestRoutes(r *cli.Router, cfg *phraseapp.Config) {
 
 	r.Register("push", &PushCommand{Config: *cfg}, "Upload locales to your PhraseApp project.\n  You can provide parameters supported by the uploads#create endpoint http://docs.phraseapp.com/api/v2/uploads/#create\n  in your configuration (.phraseapp.yml) for each source.\n  See our configuration guide for more information http://docs.phraseapp.com/developers/cli/configuration/")
 
+	r.Register("diff", &DiffCommand{Config: *cfg}, "Show the differences between your local locale files and the ones in your PhraseApp project.\n  Every file of the configured pull targets is downloaded and compared with the local file.\n  Exits with a non-zero status if any file differs.")
+
 	r.Register("init", &InitCommand{Config: *cfg}, "Configure your PhraseApp client.")
 
 	r.Register("upload/cleanup", &UploadCleanupCommand{Config: *cfg}, "Delete unmentioned keys for given upload")
 
+	r.Register("upload/cleanup-restore", &UploadCleanupRestoreCommand{Config: *cfg}, "Restore keys and translations from a backup written by upload/cleanup --backup")
+
 	r.RegisterFunc("info", infoCommand, "Info about version and revision of this client")
 }
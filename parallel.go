@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// runParallel calls work for every index in [0, n) using at most workers
+// goroutines at a time. done is called from the calling goroutine in
+// ascending order of the indices, as soon as work has returned for an index
+// and all indices before it. This way results can be reported in a
+// deterministic order while the work itself happens concurrently.
+func runParallel(n, workers int, work func(i int), done func(i int)) {
+	if workers < 1 {
+		workers = 1
+	}
+
+	finished := make([]chan struct{}, n)
+	for i := range finished {
+		finished[i] = make(chan struct{})
+	}
+
+	indices := make(chan int)
+	go func() {
+		defer close(indices)
+		for i := 0; i < n; i++ {
+			indices <- i
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers && w < n; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indices {
+				work(i)
+				close(finished[i])
+			}
+		}()
+	}
+
+	for i := 0; i < n; i++ {
+		<-finished[i]
+		done(i)
+	}
+	wg.Wait()
+}
+
+// errorList aggregates the errors of several independent tasks, so that a
+// failing task doesn't keep the others from running.
+type errorList []error
+
+func (errs errorList) Error() string {
+	if len(errs) == 1 {
+		return errs[0].Error()
+	}
+
+	msgs := make([]string, len(errs))
+	for i, err := range errs {
+		msgs[i] = "  - " + err.Error()
+	}
+	return fmt.Sprintf("%d errors occurred:\n%s", len(errs), strings.Join(msgs, "\n"))
+}
+
+// errOrNil returns nil if errs is empty. This prevents an empty errorList from
+// being returned as a non-nil error interface.
+func (errs errorList) errOrNil() error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
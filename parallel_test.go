@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRunParallel(t *testing.T) {
+	for _, workers := range []int{0, 1, 3, 20} {
+		var mu sync.Mutex
+		running, maxRunning := 0, 0
+		worked := make([]bool, 10)
+		order := []int{}
+
+		runParallel(10, workers, func(i int) {
+			mu.Lock()
+			running++
+			if running > maxRunning {
+				maxRunning = running
+			}
+			mu.Unlock()
+
+			// let later indices finish first
+			time.Sleep(time.Duration(10-i) * time.Millisecond)
+			worked[i] = true
+
+			mu.Lock()
+			running--
+			mu.Unlock()
+		}, func(i int) {
+			if !worked[i] {
+				t.Errorf("workers=%d: done called for %d before work finished", workers, i)
+			}
+			order = append(order, i)
+		})
+
+		expMax := workers
+		if expMax < 1 {
+			expMax = 1
+		}
+		if maxRunning > expMax {
+			t.Errorf("workers=%d: expected at most %d concurrent calls, got %d", workers, expMax, maxRunning)
+		}
+
+		for i, idx := range order {
+			if i != idx {
+				t.Errorf("workers=%d: expected done to be called in order, got %v", workers, order)
+				break
+			}
+		}
+		if len(order) != 10 {
+			t.Errorf("workers=%d: expected done to be called 10 times, got %d", workers, len(order))
+		}
+	}
+}
+
+func TestErrorList(t *testing.T) {
+	if err := (errorList{}).errOrNil(); err != nil {
+		t.Errorf("expected empty list to result in nil error, got %q", err)
+	}
+
+	errs := errorList{fmt.Errorf("first")}
+	if errs.Error() != "first" {
+		t.Errorf("expected single error to be returned as is, got %q", errs.Error())
+	}
+
+	errs = append(errs, fmt.Errorf("second"))
+	exp := "2 errors occurred:\n  - first\n  - second"
+	if errs.Error() != exp {
+		t.Errorf("expected %q, got %q", exp, errs.Error())
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+)
+
+// Output formats supported by the push and pull commands.
+const (
+	outputText = "text"
+	outputJSON = "json"
+)
+
+func validateOutputFormat(format string) error {
+	switch format {
+	case "", outputText, outputJSON:
+		return nil
+	default:
+		return fmt.Errorf("Output format %q is not supported, use %q or %q", format, outputText, outputJSON)
+	}
+}
+
+// Actions of a plan entry.
+const (
+	actionUpload             = "upload"
+	actionCreateLocaleUpload = "create locale and upload"
+	actionSkipUnchanged      = "skip (unchanged)"
+	actionCreateFile         = "create"
+	actionUpdateFile         = "update"
+)
+
+// planEntry describes what push or pull would do for a single locale file when
+// run without the dry-run option.
+type planEntry struct {
+	Action     string `json:"action"`
+	Path       string `json:"path"`
+	Pattern    string `json:"pattern"`
+	ProjectID  string `json:"project_id"`
+	LocaleID   string `json:"locale_id,omitempty"`
+	LocaleCode string `json:"locale_code,omitempty"`
+	LocaleName string `json:"locale_name,omitempty"`
+	Tag        string `json:"tag,omitempty"`
+}
+
+func newPlanEntry(action, pattern, projectID string, localeFile *LocaleFile) *planEntry {
+	return &planEntry{
+		Action:     action,
+		Path:       localeFile.RelPath(),
+		Pattern:    pattern,
+		ProjectID:  projectID,
+		LocaleID:   localeFile.ID,
+		LocaleCode: localeFile.Code,
+		LocaleName: localeFile.Name,
+		Tag:        localeFile.Tag,
+	}
+}
+
+type plan []*planEntry
+
+// write writes the plan to w, either as table or as JSON array.
+func (p plan) write(w io.Writer, format string) error {
+	if format == outputJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(p)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ACTION\tPATH\tPROJECT\tLOCALE ID\tLOCALE CODE\tLOCALE NAME\tTAG")
+	for _, entry := range p {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			entry.Action, entry.Path, entry.ProjectID,
+			orDash(entry.LocaleID), orDash(entry.LocaleCode), orDash(entry.LocaleName), orDash(entry.Tag),
+		)
+	}
+	return tw.Flush()
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
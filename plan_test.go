@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func getBasePlan() plan {
+	return plan{
+		{Action: actionUpload, Path: "en.yml", Pattern: "<locale_code>.yml", ProjectID: "project-id", LocaleID: "en-locale-id", LocaleCode: "en", LocaleName: "english"},
+		{Action: actionCreateLocaleUpload, Path: "fr.yml", Pattern: "<locale_code>.yml", ProjectID: "project-id", LocaleCode: "fr"},
+	}
+}
+
+func TestPlanText(t *testing.T) {
+	buf := new(bytes.Buffer)
+	if err := getBasePlan().write(buf, outputText); err != nil {
+		t.Fatalf("didn't expect an error, got: %s", err)
+	}
+
+	exp := "ACTION                    PATH    PROJECT     LOCALE ID     LOCALE CODE  LOCALE NAME  TAG\n" +
+		"upload                    en.yml  project-id  en-locale-id  en           english      -\n" +
+		"create locale and upload  fr.yml  project-id  -             fr           -            -\n"
+	if buf.String() != exp {
+		t.Errorf("expected plan\n%s\ngot\n%s", exp, buf.String())
+	}
+}
+
+func TestPlanJSON(t *testing.T) {
+	buf := new(bytes.Buffer)
+	if err := getBasePlan().write(buf, outputJSON); err != nil {
+		t.Fatalf("didn't expect an error, got: %s", err)
+	}
+
+	entries := []map[string]string{}
+	if err := json.Unmarshal(buf.Bytes(), &entries); err != nil {
+		t.Fatalf("expected valid JSON, got: %s", err)
+	}
+
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(entries))
+	}
+	if entries[1]["action"] != actionCreateLocaleUpload || entries[1]["locale_code"] != "fr" {
+		t.Errorf("unexpected second entry: %v", entries[1])
+	}
+	if _, found := entries[1]["locale_id"]; found {
+		t.Errorf("expected empty locale id to be omitted, got %v", entries[1])
+	}
+}
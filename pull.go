@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -15,6 +16,21 @@ import (
 
 type PullCommand struct {
 	phraseapp.Config
+	Parallel   int      `cli:"opt --parallel desc='Number of locales to download concurrently'"`
+	MaxRetries *int     `cli:"opt --max-retries desc='Number of times to retry failed requests'"`
+	DryRun     bool     `cli:"opt --dry-run desc='Only show which files would be written, without changing anything'"`
+	Output     string   `cli:"opt --output desc='Output format: text or json'"`
+	Check      bool     `cli:"opt --check desc='Only check if local files are up to date, without changing anything'"`
+	NoCache    bool     `cli:"opt --no-cache desc='Download all locales in full, even if they did not change since the last pull'"`
+	Locale     []string `cli:"opt --locale desc='Only pull these locales, given by code, name or ID, comma separated or repeated'"`
+	Tag        []string `cli:"opt --tag desc='Only pull files of targets with these tags, comma separated or repeated'"`
+	Target     []string `cli:"opt --target desc='Only pull these targets, given by name or position starting at 1, comma separated or repeated'"`
+
+	// remembers ETags of previous downloads for conditional requests
+	cache *downloadCache
+
+	// reports the result of every file with JSON output
+	events *eventWriter
 }
 
 func (cmd *PullCommand) Run() error {
@@ -23,8 +39,8 @@ func (cmd *PullCommand) Run() error {
 		cmd.Config.Debug = false
 		Debug = true
 	}
-	client, err := newClient(cmd.Config.Credentials, cmd.Config.Debug)
-	if err != nil {
+
+	if err := validateOutputFormat(cmd.Output); err != nil {
 		return err
 	}
 
@@ -33,65 +49,334 @@ func (cmd *PullCommand) Run() error {
 		return err
 	}
 
+	targets, err = targets.selected(cmd.Target)
+	if err != nil {
+		return err
+	}
+
+	settings, err := PullSettingsFromConfig(cmd.Config)
+	if err != nil {
+		return err
+	}
+	if cmd.Parallel == 0 {
+		cmd.Parallel = settings.Parallel
+	}
+	if cmd.MaxRetries == nil {
+		cmd.MaxRetries = settings.MaxRetries()
+	}
+
+	client, err := newClientWithRetries(cmd.Config.Credentials, cmd.Config.Debug, *cmd.MaxRetries)
+	if err != nil {
+		return err
+	}
+
+	if err := targets.fetchRemoteLocales(client); err != nil {
+		return err
+	}
+
+	return cmd.pull(client, targets)
+}
+
+// fetchRemoteLocales sets the remote locales of every target, and the remote
+// tags of targets pulling all tags.
+func (targets Targets) fetchRemoteLocales(client *phraseapp.Client) error {
 	projectIdToLocales, err := LocalesForProjects(client, targets)
 	if err != nil {
 		return err
 	}
 
+	projectIdToTags := map[string][]string{}
 	for _, target := range targets {
 		val, ok := projectIdToLocales[target.ProjectID]
 		if !ok || len(val) == 0 {
 			return fmt.Errorf("Could not find any locales for project %q", target.ProjectID)
 		}
 		target.RemoteLocales = val
-	}
 
-	for _, target := range targets {
-		err := target.Pull(client)
-		if err != nil {
-			return err
+		if target.GetTag() != tagWildcard {
+			continue
 		}
-	}
 
+		tags, ok := projectIdToTags[target.ProjectID]
+		if !ok {
+			tags, err = RemoteTags(target.client(client), target.ProjectID)
+			if err != nil {
+				return err
+			}
+			projectIdToTags[target.ProjectID] = tags
+		}
+		if len(tags) == 0 {
+			return fmt.Errorf("Could not find any tags for project %q", target.ProjectID)
+		}
+		target.RemoteTags = tags
+	}
 	return nil
 }
 
 type PullParams struct {
 	phraseapp.LocaleDownloadParams
 	LocaleID string
+	// pull one file per tag, used instead of the single tag of
+	// LocaleDownloadParams
+	Tags []string
 }
 
-func (target *Target) Pull(client *phraseapp.Client) error {
-	if err := target.CheckPreconditions(); err != nil {
-		return err
+// pullJob is the download of a single locale file of a target.
+type pullJob struct {
+	target     *Target
+	localeFile *LocaleFile
+	err        error
+
+	// set if PhraseApp reported the locale to be unchanged
+	unchanged bool
+	// set in check mode if the local file isn't up to date
+	stale string
+}
+
+func (job *pullJob) event(check bool) *fileEvent {
+	e := newFileEvent(eventDownloaded, job.target.ProjectID, job.localeFile)
+	switch {
+	case job.err != nil:
+		e.withError(job.err)
+	case check && job.stale != "":
+		e.Event = eventStale
+		e.Reason = job.stale
+	case check:
+		e.Event = eventUpToDate
+	case job.unchanged:
+		e.Event = eventUnchanged
 	}
+	return e
+}
+
+// Reasons for a local file being stale.
+const (
+	staleMissing = "missing"
+	staleDiffers = "differs"
+)
 
-	localeFiles, err := target.LocaleFiles()
+// pull downloads the locale files of all targets. With the parallel option
+// set the downloads of all targets run concurrently, while the results are
+// still reported in order. Failing downloads don't stop the others, all errors
+// are returned once every file was handled.
+func (cmd *PullCommand) pull(client *phraseapp.Client, targets Targets) error {
+	jobs, err := targets.pullJobs(&localeFileFilter{Locales: cmd.Locale, Tags: cmd.Tag})
 	if err != nil {
 		return err
 	}
 
-	for _, localeFile := range localeFiles {
-		err := createFile(localeFile.Path)
+	if len(jobs) == 0 {
+		return fmt.Errorf("None of the locales matches the given locales and tags")
+	}
+
+	if cmd.DryRun {
+		return cmd.printPlan(jobs)
+	}
+
+	if cmd.Output == outputJSON && cmd.events == nil {
+		cmd.events = newEventWriter(os.Stdout)
+	}
+
+	if cmd.Check {
+		return cmd.check(client, jobs)
+	}
+
+	if !cmd.NoCache {
+		cachePath, err := pathNextToConfig(downloadCacheFileName)
 		if err != nil {
 			return err
 		}
+		cmd.cache, err = loadDownloadCache(cachePath)
+		if err != nil {
+			return fmt.Errorf("Error reading download cache from %s: %s", cachePath, err)
+		}
+	}
+
+	errs := errorList{}
+	runParallel(len(jobs), cmd.Parallel, func(i int) {
+		job := jobs[i]
+		job.unchanged, job.err = job.target.Pull(job.target.client(client), job.localeFile, cmd.cache)
+	}, func(i int) {
+		job := jobs[i]
+		if job.err != nil {
+			errs = append(errs, fmt.Errorf("%s for %s", job.err, job.localeFile.Path))
+		}
+
+		if cmd.events != nil {
+			if err := cmd.events.write(job.event(false)); err != nil {
+				errs = append(errs, err)
+			}
+			return
+		}
+
+		switch {
+		case job.err != nil:
+			// reported together with all other errors
+		case job.unchanged:
+			print.Success("Unchanged %s at %s", job.localeFile.Message(), job.localeFile.RelPath())
+		default:
+			print.Success("Downloaded %s to %s", job.localeFile.Message(), job.localeFile.RelPath())
+		}
+	})
+
+	if cmd.cache != nil {
+		if err := cmd.cache.save(); err != nil {
+			errs = append(errs, fmt.Errorf("Error writing download cache to %s: %s", cmd.cache.path, err))
+		}
+	}
+
+	return errs.errOrNil()
+}
+
+// pullJobs checks the preconditions of all targets and returns a job for
+// every locale file to download that matches filter.
+func (targets Targets) pullJobs(filter *localeFileFilter) ([]*pullJob, error) {
+	jobs := []*pullJob{}
+	for _, target := range targets {
+		if err := target.CheckPreconditions(); err != nil {
+			return nil, err
+		}
 
-		err = target.DownloadAndWriteToFile(client, localeFile)
+		localeFiles, err := target.LocaleFiles()
 		if err != nil {
-			return fmt.Errorf("%s for %s", err, localeFile.Path)
-		} else {
-			print.Success("Downloaded %s to %s", localeFile.Message(), localeFile.RelPath())
+			return nil, err
 		}
-		if Debug {
-			fmt.Fprintln(os.Stderr, strings.Repeat("-", 10))
+
+		for _, localeFile := range localeFiles {
+			if filter.matches(localeFile) {
+				jobs = append(jobs, &pullJob{target: target, localeFile: localeFile})
+			}
 		}
 	}
+	return jobs, nil
+}
 
-	return nil
+// check downloads all locale files into memory and compares them with the
+// files on disk. An error is returned if any of them is missing or differs.
+func (cmd *PullCommand) check(client *phraseapp.Client, jobs []*pullJob) error {
+	errs := errorList{}
+	stale := 0
+	runParallel(len(jobs), cmd.Parallel, func(i int) {
+		job := jobs[i]
+		job.stale, job.err = job.target.checkUpToDate(job.target.client(client), job.localeFile)
+	}, func(i int) {
+		job := jobs[i]
+		if cmd.events != nil {
+			if err := cmd.events.write(job.event(true)); err != nil {
+				errs = append(errs, err)
+			}
+		}
+
+		switch {
+		case job.err != nil:
+			errs = append(errs, fmt.Errorf("%s for %s", job.err, job.localeFile.Path))
+		case job.stale != "":
+			stale++
+			if cmd.events == nil {
+				print.Failure("%s: %s", job.stale, job.localeFile.RelPath())
+			}
+		}
+	})
+
+	if stale > 0 {
+		errs = append(errs, fmt.Errorf("%d of %d file(s) are not up to date", stale, len(jobs)))
+	} else if len(errs) == 0 && cmd.events == nil {
+		print.Success("All %d file(s) are up to date.", len(jobs))
+	}
+	return errs.errOrNil()
+}
+
+// checkUpToDate compares the local file with the content in PhraseApp and
+// returns why it is stale, or an empty string if the file is up to date.
+func (target *Target) checkUpToDate(client *phraseapp.Client, localeFile *LocaleFile) (string, error) {
+	remote, err := target.Download(client, localeFile)
+	if err != nil {
+		return "", err
+	}
+
+	local, err := ioutil.ReadFile(localeFile.Path)
+	switch {
+	case os.IsNotExist(err):
+		return staleMissing, nil
+	case err != nil:
+		return "", err
+	case !bytes.Equal(local, remote):
+		return staleDiffers, nil
+	}
+	return "", nil
+}
+
+// printPlan prints which files would be written for which locales.
+func (cmd *PullCommand) printPlan(jobs []*pullJob) error {
+	p := plan{}
+	for _, job := range jobs {
+		action := actionUpdateFile
+		if paths.Exists(job.localeFile.Path) != nil {
+			action = actionCreateFile
+		}
+		p = append(p, newPlanEntry(action, job.target.File, job.target.ProjectID, job.localeFile))
+	}
+	return p.write(os.Stdout, cmd.Output)
+}
+
+// Pull downloads the given locale file of target and writes it to disk. If a
+// cache is given, the file is left untouched if it didn't change in
+// PhraseApp since the last download, which is reported by returning true.
+func (target *Target) Pull(client *phraseapp.Client, localeFile *LocaleFile, cache *downloadCache) (bool, error) {
+	err := paths.CreateDir(filepath.Dir(localeFile.Path), target.DirMode)
+	if err != nil {
+		return false, err
+	}
+
+	unchanged, err := target.DownloadAndWriteToFile(client, localeFile, cache)
+
+	if Debug {
+		fmt.Fprintln(os.Stderr, strings.Repeat("-", 10))
+	}
+	return unchanged, err
 }
 
-func (target *Target) DownloadAndWriteToFile(client *phraseapp.Client, localeFile *LocaleFile) error {
+func (target *Target) DownloadAndWriteToFile(client *phraseapp.Client, localeFile *LocaleFile, cache *downloadCache) (bool, error) {
+	if cache == nil {
+		res, err := target.Download(client, localeFile)
+		if err != nil {
+			return false, err
+		}
+		return false, paths.WriteFileAtomically(localeFile.Path, res, target.FileMode)
+	}
+
+	request, err := downloadRequest(target.ProjectID, localeFile.ID, target.downloadParams(localeFile))
+	if err != nil {
+		return false, err
+	}
+
+	conditionalClient, tr := withConditionalTransport(client, cache.lookup(localeFile, request))
+	res, err := target.Download(conditionalClient, localeFile)
+	if err != nil {
+		return false, err
+	}
+
+	if tr.notModified {
+		return true, nil
+	}
+
+	err = paths.WriteFileAtomically(localeFile.Path, res, target.FileMode)
+	if err != nil {
+		return false, err
+	}
+
+	if tr.etag != "" || tr.lastModified != "" {
+		cache.store(localeFile, &downloadRecord{
+			Request:      request,
+			ETag:         tr.etag,
+			LastModified: tr.lastModified,
+			Hash:         hashContent(res),
+		})
+	}
+	return false, nil
+}
+
+func (target *Target) downloadParams(localeFile *LocaleFile) *phraseapp.LocaleDownloadParams {
 	downloadParams := new(phraseapp.LocaleDownloadParams)
 	if target.Params != nil {
 		*downloadParams = target.Params.LocaleDownloadParams
@@ -101,6 +386,18 @@ func (target *Target) DownloadAndWriteToFile(client *phraseapp.Client, localeFil
 		downloadParams.FileFormat = &localeFile.FileFormat
 	}
 
+	if localeFile.Tag != "" {
+		tag := localeFile.Tag
+		downloadParams.Tag = &tag
+	}
+	return downloadParams
+}
+
+// Download returns the content of the given locale file as provided by
+// PhraseApp.
+func (target *Target) Download(client *phraseapp.Client, localeFile *LocaleFile) ([]byte, error) {
+	downloadParams := target.downloadParams(localeFile)
+
 	if Debug {
 		fmt.Fprintln(os.Stderr, "Target file pattern:", target.File)
 		fmt.Fprintln(os.Stderr, "Actual file path", localeFile.Path)
@@ -114,20 +411,11 @@ func (target *Target) DownloadAndWriteToFile(client *phraseapp.Client, localeFil
 		fmt.Fprintln(os.Stderr, "FormatOptions", downloadParams.FormatOptions)
 	}
 
-	res, err := client.LocaleDownload(target.ProjectID, localeFile.ID, downloadParams)
-	if err != nil {
-		return err
-	}
-
-	err = ioutil.WriteFile(localeFile.Path, res, 0700)
-	if err != nil {
-		return err
-	}
-	return nil
+	return client.LocaleDownload(target.ProjectID, localeFile.ID, downloadParams)
 }
 
 func (target *Target) LocaleFiles() (LocaleFiles, error) {
-	files := []*LocaleFile{}
+	var locales []*phraseapp.Locale
 
 	if target.GetLocaleID() != "" {
 		// a specific locale was requested
@@ -136,37 +424,37 @@ func (target *Target) LocaleFiles() (LocaleFiles, error) {
 			return nil, err
 		}
 
-		localeFile, err := createLocaleFile(target, remoteLocale)
-		if err != nil {
-			return nil, err
-		}
-
-		files = append(files, localeFile)
+		locales = append(locales, remoteLocale)
 
 	} else if placeholders.ContainsLocalePlaceholder(target.File) {
 		// multiple locales were requested
-		for _, remoteLocale := range target.RemoteLocales {
-			localeFile, err := createLocaleFile(target, remoteLocale)
+		locales = target.RemoteLocales
+	} else {
+		// no local files match remote locale
+		return nil, fmt.Errorf("Could not find any files on your system that matches the locales for porject %q.", target.ProjectID)
+	}
+
+	files := []*LocaleFile{}
+	for _, tag := range target.tags() {
+		for _, remoteLocale := range locales {
+			localeFile, err := createLocaleFile(target, remoteLocale, tag)
 			if err != nil {
 				return nil, err
 			}
 
 			files = append(files, localeFile)
 		}
-	} else {
-		// no local files match remote locale
-		return nil, fmt.Errorf("Could not find any files on your system that matches the locales for porject %q.", target.ProjectID)
 	}
 
 	return files, nil
 }
 
-func createLocaleFile(target *Target, remoteLocale *phraseapp.Locale) (*LocaleFile, error) {
+func createLocaleFile(target *Target, remoteLocale *phraseapp.Locale, tag string) (*LocaleFile, error) {
 	localeFile := &LocaleFile{
 		Name:       remoteLocale.Name,
 		ID:         remoteLocale.ID,
 		Code:       remoteLocale.Code,
-		Tag:        target.GetTag(),
+		Tag:        tag,
 		FileFormat: target.GetFormat(),
 		Path:       target.File,
 	}
@@ -179,22 +467,3 @@ func createLocaleFile(target *Target, remoteLocale *phraseapp.Locale) (*LocaleFi
 	localeFile.Path = absPath
 	return localeFile, nil
 }
-
-func createFile(path string) error {
-	err := paths.Exists(path)
-	if err != nil {
-		absDir := filepath.Dir(path)
-		err := paths.Exists(absDir)
-		if err != nil {
-			os.MkdirAll(absDir, 0700)
-		}
-
-		f, err := os.Create(path)
-		if err != nil {
-			return err
-		}
-		defer f.Close()
-	}
-
-	return nil
-}
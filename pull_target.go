@@ -2,7 +2,9 @@ package main
 
 import (
 	"fmt"
+	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/phrase/phraseapp-client/internal/paths"
@@ -12,6 +14,23 @@ import (
 	"gopkg.in/yaml.v2"
 )
 
+// PullSettings contains the options of the pull section in the config file
+// that apply to all targets.
+type PullSettings struct {
+	TransferSettings `yaml:",inline"`
+}
+
+func PullSettingsFromConfig(config phraseapp.Config) (*PullSettings, error) {
+	settings := new(PullSettings)
+	if err := yaml.Unmarshal(config.Targets, settings); err != nil {
+		return nil, err
+	}
+	if err := settings.validate("pull"); err != nil {
+		return nil, err
+	}
+	return settings, nil
+}
+
 type Targets []*Target
 
 func (targets Targets) ProjectIds() []string {
@@ -22,13 +41,58 @@ func (targets Targets) ProjectIds() []string {
 	return projectIds
 }
 
+// selected returns the targets given by name or position.
+func (targets Targets) selected(selectors []string) (Targets, error) {
+	names := []string{}
+	for _, target := range targets {
+		names = append(names, target.Name)
+	}
+
+	indexes, err := selectEntries("target", selectors, names)
+	if err != nil {
+		return nil, err
+	}
+
+	selected := Targets{}
+	for _, i := range indexes {
+		selected = append(selected, targets[i])
+	}
+	return selected, nil
+}
+
+func (targets Targets) Clients(client *phraseapp.Client) []*phraseapp.Client {
+	clients := []*phraseapp.Client{}
+	for _, target := range targets {
+		clients = append(clients, target.client(client))
+	}
+	return clients
+}
+
 type Target struct {
+	Name          string
 	File          string
 	ProjectID     string
 	AccessToken   string
+	Host          string
 	FileFormat    string
 	Params        *PullParams
 	RemoteLocales []*phraseapp.Locale
+	// all tags of the project, only fetched if the tag param is "*"
+	RemoteTags []string
+
+	// permissions of written files and created directories, 0 keeps the
+	// permissions of existing files and applies the umask otherwise
+	FileMode os.FileMode
+	DirMode  os.FileMode
+
+	// tokens used in the path instead of locale codes and names
+	LocaleMapping LocaleMapping
+}
+
+// client returns the client to use for the target, which differs from the
+// given one if the target has its own access token or host.
+func (target *Target) client(client *phraseapp.Client) *phraseapp.Client {
+	return withCredentials(client, target.AccessToken, target.Host)
 }
 
 func (target *Target) CheckPreconditions() error {
@@ -61,7 +125,7 @@ func containsStars(target *Target) error {
 
 func containsDuplicatePlaceholders(target *Target) error {
 	duplicatedPlaceholders := []string{}
-	for _, name := range []string{"<locale_name>", "<locale_code>", "<tag>"} {
+	for _, name := range []string{"<locale_name>", "<locale_code>", "<locale_id>", "<tag>"} {
 		if strings.Count(target.File, name) > 1 {
 			duplicatedPlaceholders = append(duplicatedPlaceholders, name)
 		}
@@ -88,9 +152,20 @@ func containsAmbiguousLocaleInformation(target *Target) error {
 }
 
 func containsInvalidTagInformation(target *Target) error {
-	if target.GetTag() == "" && placeholders.ContainsTagPlaceholder(target.File) {
+	tags := []string{}
+	if target.Params != nil {
+		tags = target.Params.Tags
+	}
+	hasPlaceholder := placeholders.ContainsTagPlaceholder(target.File)
+
+	switch {
+	case target.GetTag() != "" && len(tags) > 0:
+		return fmt.Errorf("Found 'tag' and 'tags' in params. Please only specify one of them.")
+	case target.GetTag() == "" && len(tags) == 0 && hasPlaceholder:
 		// tag provided but no params
 		return fmt.Errorf("Using <tag> placeholder but no tags were provided. Please specify a 'tag: \"my_tag\"' in the params section.")
+	case (target.GetTag() == tagWildcard || len(tags) > 1) && !hasPlaceholder:
+		return fmt.Errorf("Pulling multiple tags requires a <tag> placeholder in the file pattern, so that every tag is written to its own file.")
 	}
 	return nil
 }
@@ -111,11 +186,13 @@ func (target *Target) ReplacePlaceholders(localeFile *LocaleFile) (string, error
 		return "", err
 	}
 
-	path := strings.Replace(absPath, "<locale_name>", localeFile.Name, -1)
-	path = strings.Replace(path, "<locale_code>", localeFile.Code, -1)
-	path = strings.Replace(path, "<tag>", localeFile.Tag, -1)
-
-	return path, nil
+	return placeholders.Replace(absPath, map[string]string{
+		"locale_name": target.LocaleMapping.local(localeFile.Name),
+		"locale_code": target.LocaleMapping.local(localeFile.Code),
+		"locale_id":   localeFile.ID,
+		"tag":         localeFile.Tag,
+		"project_id":  target.ProjectID,
+	}), nil
 }
 
 func (t *Target) GetFormat() string {
@@ -142,13 +219,31 @@ func (t *Target) GetTag() string {
 	return ""
 }
 
+// tagWildcard as tag param pulls all tags of the project.
+const tagWildcard = "*"
+
+// tags returns the tags to pull a file for, for every locale. Without any
+// tags configured, a single empty tag is returned.
+func (t *Target) tags() []string {
+	switch {
+	case t.Params != nil && len(t.Params.Tags) > 0:
+		return t.Params.Tags
+	case t.GetTag() == tagWildcard:
+		return t.RemoteTags
+	case t.GetTag() != "":
+		return []string{t.GetTag()}
+	}
+	return []string{""}
+}
+
 func TargetsFromConfig(config phraseapp.Config) (Targets, error) {
 	if config.Targets == nil || len(config.Targets) == 0 {
 		return nil, fmt.Errorf("no targets for download specified")
 	}
 
 	tmp := struct {
-		Targets Targets
+		Targets       Targets
+		LocaleMapping LocaleMapping `yaml:"locale_mapping"`
 	}{}
 	err := yaml.Unmarshal(config.Targets, &tmp)
 	if err != nil {
@@ -170,6 +265,10 @@ func TargetsFromConfig(config phraseapp.Config) (Targets, error) {
 		if target.FileFormat == "" {
 			target.FileFormat = fileFormat
 		}
+		target.LocaleMapping = tmp.LocaleMapping.merge(target.LocaleMapping)
+		if err := target.LocaleMapping.validate(); err != nil {
+			return nil, err
+		}
 		validTargets = append(validTargets, target)
 	}
 
@@ -182,17 +281,35 @@ func TargetsFromConfig(config phraseapp.Config) (Targets, error) {
 
 func (tgt *Target) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	m := map[string]interface{}{}
+	var localeMapping map[string]interface{}
+	var fileMode, dirMode []byte
 	err := phraseapp.ParseYAMLToMap(unmarshal, map[string]interface{}{
-		"file":         &tgt.File,
-		"project_id":   &tgt.ProjectID,
-		"access_token": &tgt.AccessToken,
-		"file_format":  &tgt.FileFormat,
-		"params":       &m,
+		"name":           &tgt.Name,
+		"file":           &tgt.File,
+		"project_id":     &tgt.ProjectID,
+		"access_token":   &tgt.AccessToken,
+		"host":           &tgt.Host,
+		"file_format":    &tgt.FileFormat,
+		"file_mode":      &fileMode,
+		"dir_mode":       &dirMode,
+		"locale_mapping": &localeMapping,
+		"params":         &m,
 	})
 	if err != nil {
 		return err
 	}
 
+	if tgt.LocaleMapping, err = parseLocaleMapping("locale_mapping", localeMapping); err != nil {
+		return err
+	}
+
+	if tgt.FileMode, err = parseFileMode("file_mode", fileMode); err != nil {
+		return err
+	}
+	if tgt.DirMode, err = parseFileMode("dir_mode", dirMode); err != nil {
+		return err
+	}
+
 	tgt.Params = new(PullParams)
 	if v, found := m["locale_id"]; found {
 		if tgt.Params.LocaleID, err = phraseapp.ValidateIsString("params.locale_id", v); err != nil {
@@ -203,5 +320,65 @@ func (tgt *Target) UnmarshalYAML(unmarshal func(interface{}) error) error {
 		delete(m, "locale_id")
 	}
 
+	if v, found := m["tags"]; found {
+		if tgt.Params.Tags, err = parseTags("params.tags", v); err != nil {
+			return err
+		}
+		delete(m, "tags")
+	}
+
 	return tgt.Params.ApplyValuesFromMap(m)
 }
+
+// parseTags parses a list of tags, given either as YAML list or as comma
+// separated string.
+func parseTags(key string, v interface{}) ([]string, error) {
+	switch v := v.(type) {
+	case string:
+		return splitTags(v), nil
+	case []interface{}:
+		tags := []string{}
+		for _, tag := range v {
+			s, ok := tag.(string)
+			if !ok || s == "" {
+				return nil, fmt.Errorf("%s must only contain tag names, got %v", key, tag)
+			}
+			tags = append(tags, s)
+		}
+		return tags, nil
+	default:
+		return nil, fmt.Errorf("%s must be a list of tags, got %v", key, v)
+	}
+}
+
+// parseFileMode parses permissions given in octal notation. The value has to
+// be quoted ("0644"), as YAML reads unquoted numbers without a leading zero
+// (644) as decimal and the notation can't be told apart after parsing.
+func parseFileMode(key string, raw []byte) (os.FileMode, error) {
+	if raw == nil {
+		return 0, nil
+	}
+
+	var v interface{}
+	if err := yaml.Unmarshal(raw, &v); err != nil {
+		return 0, err
+	}
+
+	var mode uint64
+	switch v := v.(type) {
+	case int:
+		return 0, fmt.Errorf("%s must be quoted to be read in octal notation, e.g. \"0644\", got %v", key, v)
+	case string:
+		var err error
+		if mode, err = strconv.ParseUint(v, 8, 32); err != nil {
+			return 0, fmt.Errorf("%s must be given in octal notation, e.g. \"0644\", got %q", key, v)
+		}
+	default:
+		return 0, fmt.Errorf("%s must be given in octal notation, e.g. \"0644\", got %v", key, v)
+	}
+
+	if mode == 0 || mode > 0777 {
+		return 0, fmt.Errorf("%s must be between 0001 and 0777, got %#o", key, mode)
+	}
+	return os.FileMode(mode), nil
+}
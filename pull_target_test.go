@@ -1,10 +1,12 @@
 package main
 
 import (
+	"os"
 	"strings"
 	"testing"
 
 	"github.com/phrase/phraseapp-go/phraseapp"
+	yaml "gopkg.in/yaml.v2"
 )
 
 func getBaseTarget() *Target {
@@ -105,6 +107,59 @@ func TestPreconditions(t *testing.T) {
 	} else if !strings.Contains(err.Error(), expect) {
 		t.Errorf("Expected to fail with %q got %q", expect, err)
 	}
+
+	// tag and tags provided
+	target.Params.Tag = sPt("web")
+	target.Params.Tags = []string{"web", "mobile"}
+	expect = "Found 'tag' and 'tags' in params."
+	err = target.CheckPreconditions()
+	if err == nil {
+		t.Errorf("Expected to fail for pattern %q. Did not fail.", target.File)
+	} else if !strings.Contains(err.Error(), expect) {
+		t.Errorf("Expected to fail with %q got %q", expect, err)
+	}
+
+	// multiple tags without tag placeholder
+	target.File = "some/path/en.yml"
+	expect = "Pulling multiple tags requires a <tag> placeholder"
+	for _, params := range []*PullParams{
+		&PullParams{LocaleID: "en", Tags: []string{"web", "mobile"}},
+		&PullParams{LocaleID: "en", LocaleDownloadParams: phraseapp.LocaleDownloadParams{Tag: sPt("*")}},
+	} {
+		target.Params = params
+		err = target.CheckPreconditions()
+		if err == nil {
+			t.Errorf("Expected to fail for pattern %q. Did not fail.", target.File)
+		} else if !strings.Contains(err.Error(), expect) {
+			t.Errorf("Expected to fail with %q got %q", expect, err)
+		}
+	}
+}
+
+func TestTargetTags(t *testing.T) {
+	for _, tc := range []struct {
+		params string
+		tags   []string
+	}{
+		{"tags: [web, mobile]", []string{"web", "mobile"}},
+		{`tags: "web, mobile"`, []string{"web", "mobile"}},
+		{"tag: web", []string{"web"}},
+		{"locale_id: en", []string{""}},
+	} {
+		target := &Target{}
+		if err := yaml.Unmarshal([]byte("file: <tag>/<locale_code>.yml\nparams: {"+tc.params+"}\n"), target); err != nil {
+			t.Errorf("%s: %s", tc.params, err)
+			continue
+		}
+		if tags := target.tags(); strings.Join(tags, ",") != strings.Join(tc.tags, ",") {
+			t.Errorf("%s: expected tags %v, got %v", tc.params, tc.tags, tags)
+		}
+	}
+
+	target := &Target{}
+	if err := yaml.Unmarshal([]byte("params: {tags: [web, 1]}\n"), target); err == nil {
+		t.Errorf("expected tags with a number to fail")
+	}
 }
 
 func TestPlaceholderPreconditions(t *testing.T) {
@@ -140,3 +195,33 @@ func TestPlaceholderPreconditions(t *testing.T) {
 func sPt(s string) *string {
 	return &s
 }
+
+func TestTargetFileModes(t *testing.T) {
+	tt := []struct {
+		yaml     string
+		fileMode os.FileMode
+		dirMode  os.FileMode
+		err      string
+	}{
+		{"file: a.yml", 0, 0, ""},
+		{"file: a.yml\nfile_mode: \"0640\"\ndir_mode: \"0750\"", 0640, 0750, ""},
+		{"file: a.yml\nfile_mode: 0640", 0, 0, "file_mode must be quoted"},
+		{"file: a.yml\nfile_mode: 400", 0, 0, "file_mode must be quoted"},
+		{"file: a.yml\nfile_mode: \"0600\"", 0600, 0, ""},
+		{"file: a.yml\nfile_mode: \"rw\"", 0, 0, "file_mode must be given in octal notation"},
+		{"file: a.yml\ndir_mode: \"01777\"", 0, 0, "dir_mode must be between 0001 and 0777"},
+	}
+
+	for _, tti := range tt {
+		target := new(Target)
+		err := yaml.Unmarshal([]byte(tti.yaml), target)
+		switch {
+		case tti.err != "" && (err == nil || !strings.Contains(err.Error(), tti.err)):
+			t.Errorf("%q: expected error %q, got %v", tti.yaml, tti.err, err)
+		case tti.err == "" && err != nil:
+			t.Errorf("%q: unexpected error %s", tti.yaml, err)
+		case target.FileMode != tti.fileMode || target.DirMode != tti.dirMode:
+			t.Errorf("%q: expected modes %#o/%#o, got %#o/%#o", tti.yaml, tti.fileMode, tti.dirMode, target.FileMode, target.DirMode)
+		}
+	}
+}
@@ -1,9 +1,19 @@
 package main
 
 import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/phrase/phraseapp-go/phraseapp"
 )
 
 func TestPullLocaleFiles(t *testing.T) {
@@ -60,3 +70,350 @@ func TestResolvedPath(t *testing.T) {
 		t.Errorf("Expected the new path to eql '%s' and not %s", "/en/abc/english.yml", newPath)
 	}
 }
+
+func TestResolvedPathTransforms(t *testing.T) {
+	target := getBaseTarget()
+	target.File = "./<project_id>/<locale_code|language>/<locale_code|underscore|lower>-<locale_id>.yml"
+	localeFile := &LocaleFile{
+		Name: "english",
+		Code: "en-US",
+		ID:   "en-locale-id",
+	}
+	newPath, err := target.ReplacePlaceholders(localeFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if exp := "/project-id/en/en_us-en-locale-id.yml"; !strings.HasSuffix(newPath, exp) {
+		t.Errorf("Expected the new path to end with %q and not %s", exp, newPath)
+	}
+}
+
+func TestResolvedPathLocaleMapping(t *testing.T) {
+	target := getBaseTarget()
+	target.File = "./values-<locale_code>/<locale_name|lower>.xml"
+	target.LocaleMapping = LocaleMapping{"pt-BR": "pt-rBR", "Portuguese": "pt"}
+	localeFile := &LocaleFile{
+		Name: "Portuguese",
+		Code: "pt-BR",
+		ID:   "pt-br-locale-id",
+	}
+	newPath, err := target.ReplacePlaceholders(localeFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if exp := "/values-pt-rBR/pt.xml"; !strings.HasSuffix(newPath, exp) {
+		t.Errorf("Expected the new path to end with %q and not %s", exp, newPath)
+	}
+}
+
+type downloadHandler struct {
+	mu          sync.Mutex
+	rateLimited map[string]bool
+}
+
+func (dh *downloadHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	localeID := strings.Split(req.URL.Path, "/")[5]
+
+	dh.mu.Lock()
+	defer dh.mu.Unlock()
+
+	switch {
+	case localeID == "fr-locale-id":
+		resp.WriteHeader(http.StatusNotFound)
+	case localeID == "de-locale-id" && !dh.rateLimited[localeID]:
+		dh.rateLimited[localeID] = true
+		resp.Header().Set("X-Rate-Limit-Limit", "1000")
+		resp.Header().Set("X-Rate-Limit-Remaining", "999")
+		resp.Header().Set("X-Rate-Limit-Reset", fmt.Sprintf("%d", time.Now().Unix()))
+		resp.WriteHeader(http.StatusTooManyRequests)
+		fmt.Fprint(resp, "Concurrency limit exceeded")
+	default:
+		fmt.Fprintf(resp, "content of %s", localeID)
+	}
+}
+
+func TestPullParallel(t *testing.T) {
+	d, err := ioutil.TempDir("", "phrase-pull-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(d)
+
+	srv := httptest.NewServer(&downloadHandler{rateLimited: map[string]bool{}})
+	defer srv.Close()
+
+	c, err := newClient(phraseapp.Credentials{Host: srv.URL, Token: "some_token"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	target := getBaseTarget()
+	target.File = filepath.Join(d, "<locale_code>.yml")
+	target.RemoteLocales = append(getBaseLocales(), &phraseapp.Locale{Code: "fr", ID: "fr-locale-id", Name: "french"})
+
+	cmd := &PullCommand{Parallel: 3, NoCache: true}
+	err = cmd.pull(c, Targets{target})
+
+	if err == nil {
+		t.Fatalf("expected an error for the missing locale, got none")
+	}
+	if !strings.Contains(err.Error(), filepath.Join(d, "fr.yml")) || strings.Contains(err.Error(), "de.yml") {
+		t.Errorf("expected the error to only mention fr.yml, got %q", err)
+	}
+
+	for _, code := range []string{"en", "de"} {
+		content, err := ioutil.ReadFile(filepath.Join(d, code+".yml"))
+		if err != nil {
+			t.Errorf("expected %s.yml to be written, got: %s", code, err)
+			continue
+		}
+		if exp := "content of " + code + "-locale-id"; string(content) != exp {
+			t.Errorf("expected %s.yml to contain %q, got %q", code, exp, content)
+		}
+	}
+}
+
+func TestPullCheck(t *testing.T) {
+	d, err := ioutil.TempDir("", "phrase-pull-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(d)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		fmt.Fprintf(resp, "content of %s", strings.Split(req.URL.Path, "/")[5])
+	}))
+	defer srv.Close()
+
+	c, err := newClient(phraseapp.Credentials{Host: srv.URL, Token: "some_token"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	target := getBaseTarget()
+	target.File = filepath.Join(d, "<locale_code>.yml")
+
+	enPath := filepath.Join(d, "en.yml")
+	if err := ioutil.WriteFile(enPath, []byte("outdated"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := &PullCommand{Check: true, Parallel: 2}
+	err = cmd.pull(c, Targets{target})
+	if err == nil || !strings.Contains(err.Error(), "2 of 2 file(s) are not up to date") {
+		t.Errorf("expected both files to be reported as stale, got: %v", err)
+	}
+
+	content, _ := ioutil.ReadFile(enPath)
+	if string(content) != "outdated" {
+		t.Errorf("expected check mode to leave %s untouched, got %q", enPath, content)
+	}
+	if _, err := os.Stat(filepath.Join(d, "de.yml")); !os.IsNotExist(err) {
+		t.Errorf("expected check mode to not create de.yml")
+	}
+
+	for _, code := range []string{"en", "de"} {
+		p := filepath.Join(d, code+".yml")
+		if err := ioutil.WriteFile(p, []byte("content of "+code+"-locale-id"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := cmd.pull(c, Targets{target}); err != nil {
+		t.Errorf("expected files to be up to date, got: %s", err)
+	}
+}
+
+type etagHandler struct {
+	mu          sync.Mutex
+	notModified int
+}
+
+func (eh *etagHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	eh.mu.Lock()
+	defer eh.mu.Unlock()
+
+	if req.Header.Get("If-None-Match") == `"v1"` {
+		eh.notModified++
+		resp.WriteHeader(http.StatusNotModified)
+		return
+	}
+	resp.Header().Set("ETag", `"v1"`)
+	fmt.Fprintf(resp, "content of %s", strings.Split(req.URL.Path, "/")[5])
+}
+
+func TestPullConditionalDownload(t *testing.T) {
+	d, err := ioutil.TempDir("", "phrase-pull-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(d)
+
+	defer func(dir string) { configDir = dir }(configDir)
+	configDir = d
+
+	eh := new(etagHandler)
+	srv := httptest.NewServer(eh)
+	defer srv.Close()
+
+	c, err := newClient(phraseapp.Credentials{Host: srv.URL, Token: "some_token"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	target := getBaseTarget()
+	target.File = filepath.Join(d, "<locale_code>.yml")
+	enPath := filepath.Join(d, "en.yml")
+
+	pull := func() {
+		if err := (&PullCommand{Parallel: 2}).pull(c, Targets{target}); err != nil {
+			t.Fatalf("didn't expect an error, got: %s", err)
+		}
+	}
+
+	pull()
+	if eh.notModified != 0 {
+		t.Errorf("expected no conditional requests on first pull, got %d", eh.notModified)
+	}
+
+	pull()
+	if eh.notModified != 2 {
+		t.Errorf("expected both locales to be reported unchanged, got %d", eh.notModified)
+	}
+
+	if err := ioutil.WriteFile(enPath, []byte("local change"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	pull()
+	if eh.notModified != 3 {
+		t.Errorf("expected only de to be requested conditionally, got %d not modified responses", eh.notModified)
+	}
+
+	content, _ := ioutil.ReadFile(enPath)
+	if string(content) != "content of en-locale-id" {
+		t.Errorf("expected locally modified file to be downloaded again, got %q", content)
+	}
+}
+
+func TestPullTargetCredentials(t *testing.T) {
+	d, err := ioutil.TempDir("", "phrase-pull-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(d)
+
+	tokenSrv := func(name string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+			fmt.Fprintf(resp, "%s %s", name, req.Header.Get("Authorization"))
+		}))
+	}
+	defaultSrv, otherSrv := tokenSrv("default"), tokenSrv("other")
+	defer defaultSrv.Close()
+	defer otherSrv.Close()
+
+	c, err := newClient(phraseapp.Credentials{Host: defaultSrv.URL, Token: "config_token"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	global := getBaseTarget()
+	global.File = filepath.Join(d, "global", "<locale_code>.yml")
+	global.AccessToken = ""
+
+	own := getBaseTarget()
+	own.File = filepath.Join(d, "own", "<locale_code>.yml")
+	own.AccessToken = "target_token"
+	own.Host = otherSrv.URL
+
+	cmd := &PullCommand{NoCache: true}
+	if err := cmd.pull(c, Targets{global, own}); err != nil {
+		t.Fatal(err)
+	}
+
+	for dir, exp := range map[string]string{"global": "default token config_token", "own": "other token target_token"} {
+		content, err := ioutil.ReadFile(filepath.Join(d, dir, "en.yml"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(content) != exp {
+			t.Errorf("expected %s/en.yml to contain %q, got %q", dir, exp, content)
+		}
+	}
+}
+
+func TestPullMultipleTags(t *testing.T) {
+	d, err := ioutil.TempDir("", "phrase-pull-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(d)
+
+	tagRequests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		switch {
+		case strings.HasSuffix(req.URL.Path, "/locales"):
+			fmt.Fprint(resp, `[{"id":"en-locale-id","code":"en","name":"english"},{"id":"de-locale-id","code":"de","name":"german"}]`)
+		case strings.HasSuffix(req.URL.Path, "/tags"):
+			tagRequests++
+			fmt.Fprint(resp, `[{"name":"web"},{"name":"mobile"}]`)
+		case strings.HasSuffix(req.URL.Path, "/download"):
+			params := map[string]interface{}{}
+			if err := json.NewDecoder(req.Body).Decode(&params); err != nil {
+				t.Error(err)
+			}
+			fmt.Fprintf(resp, "%s %v", filepath.Base(filepath.Dir(req.URL.Path)), params["tag"])
+		default:
+			t.Errorf("unexpected request %s", req.URL.Path)
+		}
+	}))
+	defer srv.Close()
+
+	c, err := newClient(phraseapp.Credentials{Host: srv.URL, Token: "some_token"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	listed := getBaseTarget()
+	listed.File = filepath.Join(d, "listed", "<tag>", "<locale_code>.yml")
+	listed.Params.Tags = []string{"a", "b"}
+
+	all := getBaseTarget()
+	all.File = filepath.Join(d, "all", "<tag>", "<locale_code>.yml")
+	all.Params.Tag = sPt("*")
+
+	allAgain := getBaseTarget()
+	allAgain.File = filepath.Join(d, "again", "<tag>", "<locale_code>.yml")
+	allAgain.Params.Tag = sPt("*")
+
+	targets := Targets{listed, all, allAgain}
+	if err := targets.fetchRemoteLocales(c); err != nil {
+		t.Fatal(err)
+	}
+	if tagRequests != 1 {
+		t.Errorf("expected tags of the project to be fetched once, got %d requests", tagRequests)
+	}
+
+	cmd := &PullCommand{NoCache: true}
+	if err := cmd.pull(c, targets); err != nil {
+		t.Fatal(err)
+	}
+
+	for dir, tags := range map[string][]string{"listed": {"a", "b"}, "all": {"web", "mobile"}} {
+		for _, tag := range tags {
+			for _, locale := range []string{"en", "de"} {
+				path := filepath.Join(d, dir, tag, locale+".yml")
+				content, err := ioutil.ReadFile(path)
+				if err != nil {
+					t.Error(err)
+					continue
+				}
+				if exp := locale + "-locale-id " + tag; string(content) != exp {
+					t.Errorf("expected %s to contain %q, got %q", path, exp, content)
+				}
+			}
+		}
+	}
+}
@@ -2,22 +2,52 @@ package main
 
 import (
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
+	"text/tabwriter"
 	"time"
 
 	"github.com/jpillora/backoff"
 	"github.com/phrase/phraseapp-client/internal/paths"
 	"github.com/phrase/phraseapp-client/internal/placeholders"
 	"github.com/phrase/phraseapp-client/internal/print"
-	"github.com/phrase/phraseapp-client/internal/spinner"
+	"github.com/phrase/phraseapp-client/internal/progress"
 	"github.com/phrase/phraseapp-go/phraseapp"
 )
 
 type PushCommand struct {
 	phraseapp.Config
-	Wait bool `cli:"opt --wait desc='Wait for files to be processed'"`
+	Wait                 bool     `cli:"opt --wait desc='Wait for files to be processed'"`
+	WaitTimeout          string   `cli:"opt --wait-timeout desc='Maximum time to wait for a file to be processed, e.g. 10m'"`
+	Parallel             int      `cli:"opt --parallel desc='Number of files to upload concurrently'"`
+	MaxRetries           *int     `cli:"opt --max-retries desc='Number of times to retry failed requests'"`
+	DryRun               bool     `cli:"opt --dry-run desc='Only show which files would be uploaded, without changing anything'"`
+	Output               string   `cli:"opt --output desc='Output format: text or json'"`
+	Force                bool     `cli:"opt --force desc='Upload files even if they did not change since the last upload'"`
+	Cleanup              bool     `cli:"opt --cleanup desc='Delete keys not mentioned in any of the uploaded files, requires --wait'"`
+	Confirm              bool     `cli:"opt --confirm desc='Don’t ask for confirmation before deleting keys'"`
+	Locale               []string `cli:"opt --locale desc='Only push files of these locales, given by code, name or ID, comma separated or repeated'"`
+	Tag                  []string `cli:"opt --tag desc='Only push files with these tags, comma separated or repeated'"`
+	Source               []string `cli:"opt --source desc='Only push these sources, given by name or position starting at 1, comma separated or repeated'"`
+	StrictLocaleMatching bool     `cli:"opt --strict-locale-matching desc='Match locales only by their exact name, code or ID'"`
+
+	// serializes locale creation, so that concurrent uploads for the same
+	// locale don't try to create it twice.
+	createLocaleMu sync.Mutex
+
+	// records successful uploads to skip unchanged files next time
+	state *uploadState
+
+	// reports the result of every file with JSON output
+	events *eventWriter
+
+	// parsed from WaitTimeout, 0 waits forever
+	waitTimeout time.Duration
 }
 
 func (cmd *PushCommand) Run() error {
@@ -27,26 +57,74 @@ func (cmd *PushCommand) Run() error {
 		Debug = true
 	}
 
-	client, err := newClient(cmd.Config.Credentials, cmd.Config.Debug)
-	if err != nil {
+	if err := validateOutputFormat(cmd.Output); err != nil {
 		return err
 	}
 
+	if cmd.WaitTimeout != "" {
+		if !cmd.Wait {
+			return fmt.Errorf("--wait-timeout can only be used together with --wait")
+		}
+
+		timeout, err := time.ParseDuration(cmd.WaitTimeout)
+		if err != nil || timeout <= 0 {
+			return fmt.Errorf("--wait-timeout must be a positive duration like 90s or 10m, got %q", cmd.WaitTimeout)
+		}
+		cmd.waitTimeout = timeout
+	}
+
+	if cmd.Cleanup && !cmd.Wait {
+		return fmt.Errorf("--cleanup can only be used together with --wait")
+	}
+	if cmd.Cleanup && (len(cmd.Locale) > 0 || len(cmd.Tag) > 0 || len(cmd.Source) > 0) {
+		// the keys of all files not pushed would be deleted
+		return fmt.Errorf("--cleanup can't be combined with --locale, --tag or --source")
+	}
+	if cmd.Cleanup && cmd.Output == outputJSON && !cmd.Confirm {
+		return fmt.Errorf("--cleanup with JSON output requires --confirm")
+	}
+
 	sources, err := SourcesFromConfig(cmd.Config)
 	if err != nil {
 		return err
 	}
 
+	sources, err = sources.selected(cmd.Source)
+	if err != nil {
+		return err
+	}
+
 	if err := sources.Validate(); err != nil {
 		return err
 	}
 
-	formatMap, err := formatsByApiName(client)
+	settings, err := PushSettingsFromConfig(cmd.Config)
+	if err != nil {
+		return err
+	}
+	if cmd.Parallel == 0 {
+		cmd.Parallel = settings.Parallel
+	}
+	if cmd.MaxRetries == nil {
+		cmd.MaxRetries = settings.MaxRetries()
+	}
+	if !cmd.StrictLocaleMatching {
+		cmd.StrictLocaleMatching = settings.StrictLocaleMatching
+	}
+
+	client, err := newClientWithRetries(cmd.Config.Credentials, cmd.Config.Debug, *cmd.MaxRetries)
+	if err != nil {
+		return err
+	}
+
+	formatMap, err := formatsByApiName(sources[0].client(client))
 	if err != nil {
 		return fmt.Errorf("Error retrieving format list from PhraseApp: %s", err)
 	}
 
 	for _, source := range sources {
+		source.strictLocaleMatching = cmd.StrictLocaleMatching
+
 		formatName := source.GetFileFormat()
 		if val, ok := formatMap[formatName]; ok {
 			source.Format = val
@@ -68,78 +146,378 @@ func (cmd *PushCommand) Run() error {
 		}
 	}
 
+	return cmd.push(client, sources)
+}
+
+// pushJob is the upload of a single locale file of a source.
+type pushJob struct {
+	source     *Source
+	localeFile *LocaleFile
+	out        *print.Buffer
+	err        error
+
+	// set once the file was uploaded, updated with the processing result
+	upload *phraseapp.Upload
+	// why the file wasn't uploaded
+	skipped string
+}
+
+func (job *pushJob) event() *fileEvent {
+	e := newFileEvent(eventUploaded, job.source.ProjectID, job.localeFile)
+	if job.upload != nil {
+		e.withUpload(job.upload)
+	}
+
+	switch {
+	case job.err != nil:
+		e.withError(job.err)
+	case job.skipped != "":
+		e.Event = eventSkipped
+		e.Reason = job.skipped
+	}
+	return e
+}
+
+// push uploads the locale files of all sources. With the parallel option set
+// the uploads of all sources run concurrently, while the output is still
+// printed file by file in order. With the wait option set all files are
+// uploaded first and their processing is awaited afterwards. Failing uploads
+// don't stop the others, all errors are returned once every file was handled.
+func (cmd *PushCommand) push(client *phraseapp.Client, sources Sources) error {
+	filter := &localeFileFilter{Locales: cmd.Locale, Tags: cmd.Tag}
+	jobs := []*pushJob{}
 	for _, source := range sources {
-		err := source.Push(client, cmd.Wait)
+		localeFiles, err := source.LocaleFiles()
 		if err != nil {
 			return err
 		}
+
+		for _, localeFile := range localeFiles {
+			if filter.matches(localeFile, source.tags()...) {
+				jobs = append(jobs, &pushJob{source: source, localeFile: localeFile})
+			}
+		}
+	}
+
+	if len(jobs) == 0 {
+		return fmt.Errorf("None of the files matches the given locales and tags")
 	}
-	return nil
-}
 
-func (source *Source) Push(client *phraseapp.Client, waitForResults bool) error {
-	localeFiles, err := source.LocaleFiles()
+	statePath, err := pathNextToConfig(uploadStateFileName)
 	if err != nil {
 		return err
 	}
+	cmd.state, err = loadUploadState(statePath)
+	if err != nil {
+		return fmt.Errorf("Error reading upload state from %s: %s", statePath, err)
+	}
 
-	for _, localeFile := range localeFiles {
-		fmt.Printf("Uploading %s... ", localeFile.RelPath())
+	if cmd.DryRun {
+		return cmd.printPlan(client, jobs)
+	}
 
-		if localeFile.shouldCreateLocale(source) {
-			localeDetails, err := source.createLocale(client, localeFile)
-			if err == nil {
-				localeFile.ID = localeDetails.ID
-				localeFile.Code = localeDetails.Code
-				localeFile.Name = localeDetails.Name
-			} else {
-				fmt.Printf("failed to create locale: %s\n", err)
-				continue
+	if cmd.Output == outputJSON && cmd.events == nil {
+		cmd.events = newEventWriter(os.Stdout)
+	}
+
+	// human readable output is only recorded, but never printed, with JSON
+	// output
+	direct := cmd.Parallel <= 1 && cmd.events == nil
+	for _, job := range jobs {
+		job.out = &print.Buffer{Direct: direct}
+	}
+
+	errs := errorList{}
+	report := func(job *pushJob) {
+		if cmd.events != nil {
+			if err := cmd.events.write(job.event()); err != nil {
+				errs = append(errs, err)
 			}
 		}
+		if job.err != nil {
+			errs = append(errs, fmt.Errorf("%s: %s", job.localeFile.RelPath(), job.err))
+		}
+	}
 
-		upload, err := source.uploadFile(client, localeFile)
-		if err != nil {
-			return err
+	runParallel(len(jobs), cmd.Parallel, func(i int) {
+		job := jobs[i]
+		job.err = cmd.pushLocaleFile(job.source.client(client), job)
+	}, func(i int) {
+		job := jobs[i]
+		if cmd.events == nil {
+			job.out.Flush()
+		}
+		if !cmd.Wait {
+			report(job)
 		}
+	})
 
-		if waitForResults {
-			fmt.Println()
+	if cmd.Wait {
+		cmd.waitForUploads(client, jobs)
+		for _, job := range jobs {
+			report(job)
+		}
+		if cmd.events == nil {
+			printUploadSummary(os.Stdout, jobs)
+		}
 
-			taskResult := make(chan string, 1)
-			taskErr := make(chan error, 1)
+		if cmd.Cleanup {
+			errs = append(errs, cmd.cleanup(client, jobs)...)
+		}
+	}
+
+	if err := cmd.state.save(); err != nil {
+		errs = append(errs, fmt.Errorf("Error writing upload state to %s: %s", cmd.state.path, err))
+	}
 
-			fmt.Printf("Upload ID: %s, filename: %s suceeded. Waiting for your file to be processed... ", upload.ID, upload.Filename)
-			spinner.While(func() {
-				result, err := getUploadResult(client, source.ProjectID, upload)
-				taskResult <- result
-				taskErr <- err
-			})
-			fmt.Println()
+	return errs.errOrNil()
+}
 
-			if err := <-taskErr; err != nil {
+// printPlan prints which files would be uploaded to which locales. Locales
+// that don't exist yet are looked up, but not created.
+func (cmd *PushCommand) printPlan(client *phraseapp.Client, jobs []*pushJob) error {
+	p := plan{}
+	for _, job := range jobs {
+		action := actionUpload
+		if cmd.skipUnchanged() && cmd.unchanged(job.source.client(client), job.source, job.localeFile) {
+			action = actionSkipUnchanged
+		} else if job.localeFile.shouldCreateLocale(job.source) {
+			localeDetails, found, err := job.source.getLocaleIfExist(job.source.client(client), job.localeFile)
+			if err != nil {
 				return err
 			}
 
-			switch <-taskResult {
-			case "success":
-				print.Success("Successfully uploaded and processed %s.", localeFile.RelPath())
-			case "error":
-				print.Failure("There was an error processing %s. Your changes were not saved online.", localeFile.RelPath())
+			if found {
+				job.localeFile.ID = localeDetails.ID
+				job.localeFile.Code = localeDetails.Code
+				job.localeFile.Name = localeDetails.Name
+			} else {
+				action = actionCreateLocaleUpload
+			}
+		}
+		p = append(p, newPlanEntry(action, job.source.File, job.source.ProjectID, job.localeFile))
+	}
+	return p.write(os.Stdout, cmd.Output)
+}
+
+// skipUnchanged returns whether files that didn't change since the last
+// upload should be skipped. With cleanup all files must be uploaded, as the
+// keys of skipped files would be deleted otherwise.
+func (cmd *PushCommand) skipUnchanged() bool {
+	return !cmd.Force && !cmd.Cleanup
+}
+
+// cleanup deletes the keys not mentioned in any of the uploads, separately for
+// every project. Projects are left alone if any of their files failed to
+// upload or process.
+func (cmd *PushCommand) cleanup(client *phraseapp.Client, jobs []*pushJob) errorList {
+	projectIDs := []string{}
+	clients := map[string]*phraseapp.Client{}
+	uploadIDs := map[string][]string{}
+	incomplete := map[string]bool{}
+	for _, job := range jobs {
+		projectID := job.source.ProjectID
+		if _, found := clients[projectID]; !found {
+			projectIDs = append(projectIDs, projectID)
+			clients[projectID] = job.source.client(client)
+		}
+
+		if job.err != nil || job.upload == nil || job.upload.State != "success" {
+			incomplete[projectID] = true
+			continue
+		}
+		uploadIDs[projectID] = append(uploadIDs[projectID], job.upload.ID)
+	}
+
+	var w io.Writer = os.Stdout
+	if cmd.events != nil {
+		w = ioutil.Discard
+	}
+
+	errs := errorList{}
+	var total int64
+	for _, projectID := range projectIDs {
+		if incomplete[projectID] {
+			errs = append(errs, fmt.Errorf("Skipped cleanup of project %s, as not all files were uploaded successfully", projectID))
+			continue
+		}
+
+		fmt.Fprintf(w, "Cleaning up project %s...\n", projectID)
+		deleted, err := uploadCleanup(clients[projectID], projectID, uploadIDs[projectID], cleanupOptions{Confirm: cmd.Confirm}, w)
+		total += deleted
+		if err != nil {
+			errs = append(errs, fmt.Errorf("Error cleaning up project %s: %s", projectID, err))
+			continue
+		}
+
+		if cmd.events != nil {
+			e := &fileEvent{Event: eventCleanedUp, ProjectID: projectID, DeletedKeys: &deleted}
+			if err := cmd.events.write(e); err != nil {
+				errs = append(errs, err)
 			}
+		}
+	}
+
+	if cmd.events == nil {
+		print.Success("Deleted %d key(s) in total.", total)
+	}
+	return errs
+}
+
+// printUploadSummary prints a table with the processing results of all
+// uploads that finished processing, followed by the totals of all of them.
+func printUploadSummary(w io.Writer, jobs []*pushJob) {
+	total := phraseapp.SummaryType{}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "FILE\tSTATE\tKEYS CREATED\tTRANSLATIONS CREATED\tTRANSLATIONS UPDATED\tTAGS CREATED\tLOCALES CREATED")
+
+	row := func(name, state string, s phraseapp.SummaryType) {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%d\t%d\t%d\n",
+			name, state, s.TranslationKeysCreated, s.TranslationsCreated, s.TranslationsUpdated, s.TagsCreated, s.LocalesCreated,
+		)
+	}
+
+	processed := 0
+	for _, job := range jobs {
+		if job.upload == nil || (job.upload.State != "success" && job.upload.State != "error") {
+			continue
+		}
+		processed++
+
+		s := job.upload.Summary
+		row(job.localeFile.RelPath(), job.upload.State, s)
+		total.TranslationKeysCreated += s.TranslationKeysCreated
+		total.TranslationsCreated += s.TranslationsCreated
+		total.TranslationsUpdated += s.TranslationsUpdated
+		total.TagsCreated += s.TagsCreated
+		total.LocalesCreated += s.LocalesCreated
+	}
+
+	if processed == 0 {
+		return
+	}
+
+	row("TOTAL", fmt.Sprintf("%d file(s)", processed), total)
+	fmt.Fprintln(w)
+	tw.Flush()
+}
+
+func (cmd *PushCommand) pushLocaleFile(client *phraseapp.Client, job *pushJob) error {
+	source, localeFile, out := job.source, job.localeFile, job.out
+
+	if cmd.skipUnchanged() && cmd.unchanged(client, source, localeFile) {
+		job.skipped = "unchanged"
+		out.Printf("Skipping %s, it did not change since the last upload.\n", localeFile.RelPath())
+		return nil
+	}
+
+	out.Printf("Uploading %s... ", localeFile.RelPath())
+
+	if localeFile.shouldCreateLocale(source) {
+		cmd.createLocaleMu.Lock()
+		localeDetails, err := source.createLocale(client, localeFile)
+		cmd.createLocaleMu.Unlock()
+		if err == nil {
+			localeFile.ID = localeDetails.ID
+			localeFile.Code = localeDetails.Code
+			localeFile.Name = localeDetails.Name
 		} else {
-			fmt.Println("done!")
-			fmt.Printf("Check upload ID: %s, filename: %s for information about processing results.\n", upload.ID, upload.Filename)
+			out.Printf("failed!\n")
+			return fmt.Errorf("failed to create locale: %s", err)
 		}
+	}
 
-		if Debug {
-			fmt.Fprintln(os.Stderr, strings.Repeat("-", 10))
+	upload, err := source.uploadFile(client, localeFile)
+	if err != nil {
+		out.Printf("failed!\n")
+		return err
+	}
+	job.upload = upload
+
+	out.Printf("done!\n")
+	if !cmd.Wait {
+		if err := cmd.state.recordPending(source, localeFile, upload.ID); err != nil {
+			return err
 		}
+		out.Printf("Check upload ID: %s, filename: %s for information about processing results.\n", upload.ID, upload.Filename)
+	}
+
+	if Debug {
+		fmt.Fprintln(os.Stderr, strings.Repeat("-", 10))
 	}
 
 	return nil
 }
 
+// unchanged returns true if the locale file was already uploaded with the
+// same content and parameters and processing of that upload succeeded. An
+// upload that wasn't waited for is looked up to find out whether it did.
+func (cmd *PushCommand) unchanged(client *phraseapp.Client, source *Source, localeFile *LocaleFile) bool {
+	unchanged, pending := cmd.state.lookup(source, localeFile)
+	if !unchanged || pending == "" {
+		return unchanged
+	}
+
+	upload, err := client.UploadShow(source.ProjectID, pending)
+	if err != nil || upload.State != "success" {
+		return false
+	}
+	cmd.state.confirm(source, localeFile)
+	return true
+}
+
+// waitForUploads polls all uploads until they were processed, using as many
+// concurrent requests as uploading them did. The state of every upload is
+// shown while waiting, unless the output format is JSON.
+func (cmd *PushCommand) waitForUploads(client *phraseapp.Client, jobs []*pushJob) {
+	uploaded := []*pushJob{}
+	labels := []string{}
+	for _, job := range jobs {
+		if job.err == nil && job.upload != nil {
+			uploaded = append(uploaded, job)
+			labels = append(labels, job.localeFile.RelPath())
+		}
+	}
+	if len(uploaded) == 0 {
+		return
+	}
+
+	var w io.Writer = os.Stdout
+	if cmd.events != nil {
+		w = ioutil.Discard
+	} else {
+		fmt.Println("Waiting for your files to be processed...")
+	}
+	display := progress.New(w, labels)
+
+	runParallel(len(uploaded), cmd.Parallel, func(i int) {
+		job := uploaded[i]
+		job.err = cmd.waitForUpload(job.source.client(client), job, func(state string) {
+			display.Set(i, state)
+		})
+	}, func(int) {})
+}
+
+// waitForUpload waits until the upload of job was processed and records the
+// file as uploaded if processing succeeded. Every state the upload is in is
+// passed to setState.
+func (cmd *PushCommand) waitForUpload(client *phraseapp.Client, job *pushJob, setState func(string)) error {
+	setState(job.upload.State)
+	upload, err := getUploadResult(client, job.source.ProjectID, job.upload, cmd.waitTimeout, func(upload *phraseapp.Upload) {
+		setState(upload.State)
+	})
+	if err != nil {
+		setState("failed")
+		return err
+	}
+	job.upload = upload
+
+	if upload.State == "error" {
+		return fmt.Errorf("processing of upload %s failed", upload.ID)
+	}
+	return cmd.state.record(job.source, job.localeFile)
+}
+
 func formatsByApiName(client *phraseapp.Client) (map[string]*phraseapp.Format, error) {
 	formats, err := client.FormatsList(1, 25)
 	if err != nil {
@@ -154,7 +532,10 @@ func formatsByApiName(client *phraseapp.Client) (map[string]*phraseapp.Format, e
 
 // Return all locale files from disk that match the source pattern.
 func (source *Source) LocaleFiles() (LocaleFiles, error) {
-	filePaths, err := paths.Glob(placeholders.ToGlobbingPattern(source.File))
+	// only files of the source's project are pushed
+	pattern := placeholders.Replace(source.File, map[string]string{"project_id": source.ProjectID})
+
+	filePaths, err := paths.Glob(placeholders.ToGlobbingPattern(pattern))
 	if err != nil {
 		return nil, err
 	}
@@ -166,14 +547,27 @@ func (source *Source) LocaleFiles() (LocaleFiles, error) {
 		}
 
 		localeFile := new(LocaleFile)
-		localeFile.fillFromPath(path, source.File)
+		localeFile.fillFromPath(path, pattern)
+		localeFile.Code = source.LocaleMapping.remote(localeFile.Code)
+		localeFile.Name = source.LocaleMapping.remote(localeFile.Name)
 
 		localeFile.Path, err = filepath.Abs(path)
 		if err != nil {
 			return nil, err
 		}
 
-		locale := source.getRemoteLocaleForLocaleFile(localeFile)
+		locale, err := source.getRemoteLocaleForLocaleFile(localeFile)
+		if err != nil {
+			return nil, err
+		}
+
+		if locale == nil && localeFile.hasUnresolvedLocale(source) {
+			return nil, fmt.Errorf(
+				"%s matches no remote locale by %s\nA locale can't be created from transformed placeholders, please create it in PhraseApp first.",
+				localeFile.RelPath(), strings.Join(localeFile.transformedLocale(), ", "),
+			)
+		}
+
 		// TODO: sinnvoll?
 		if locale != nil {
 			localeFile.ExistsRemote = true
@@ -203,16 +597,20 @@ func (source *Source) LocaleFiles() (LocaleFiles, error) {
 	return localeFiles, nil
 }
 
-func (source *Source) getRemoteLocaleForLocaleFile(localeFile *LocaleFile) *phraseapp.Locale {
+// getRemoteLocaleForLocaleFile returns the remote locale matching the locale
+// information of the file and the locale_id param of the source, or nil if
+// there is none. An error is returned if several remote locales match.
+func (source *Source) getRemoteLocaleForLocaleFile(localeFile *LocaleFile) (*phraseapp.Locale, error) {
 	candidates := source.RemoteLocales
 
-	filterApplied := false
+	// descriptions of the applied filters for error messages
+	filters := []string{}
 
-	filter := func(cands []*phraseapp.Locale, preCond string, pred func(cand *phraseapp.Locale) bool) []*phraseapp.Locale {
+	filter := func(cands []*phraseapp.Locale, preCond, desc string, pred func(cand *phraseapp.Locale) bool) []*phraseapp.Locale {
 		if preCond == "" {
 			return cands
 		}
-		filterApplied = true
+		filters = append(filters, desc)
 		tmpCands := []*phraseapp.Locale{}
 		for _, cand := range cands {
 			if pred(cand) {
@@ -223,42 +621,82 @@ func (source *Source) getRemoteLocaleForLocaleFile(localeFile *LocaleFile) *phra
 	}
 
 	localeName := source.replacePlaceholderInParams(localeFile)
-	if localeName != "" {
+	switch {
+	case localeName != "" && source.strictLocaleMatching:
+		candidates = filter(candidates, localeName, fmt.Sprintf("locale_id %q", localeName), func(cand *phraseapp.Locale) bool {
+			return cand.Name == localeName || cand.ID == localeName
+		})
+	case localeName != "":
 		// This means the name can contain the value specified in LocaleID, with
 		// `<locale_code>` being substituted by the value of the currently handled
 		// localeFile (like push only locales with name `en-US`).
-		candidates = filter(candidates, localeName, func(cand *phraseapp.Locale) bool {
+		candidates = filter(candidates, localeName, fmt.Sprintf("name containing %q", localeName), func(cand *phraseapp.Locale) bool {
 			return strings.Contains(cand.Name, localeName)
 		})
-	} else {
+	default:
 		localeID := source.GetLocaleID()
-		candidates = filter(candidates, localeID, func(cand *phraseapp.Locale) bool {
+		candidates = filter(candidates, localeID, fmt.Sprintf("locale_id %q", localeID), func(cand *phraseapp.Locale) bool {
 			return cand.Name == localeID || cand.ID == localeID
 		})
 	}
 
-	candidates = filter(candidates, localeFile.Name, func(cand *phraseapp.Locale) bool {
+	candidates = filter(candidates, localeFile.Name, fmt.Sprintf("name %q", localeFile.Name), func(cand *phraseapp.Locale) bool {
 		return cand.Name == localeFile.Name
 	})
 
-	candidates = filter(candidates, localeFile.Code, func(cand *phraseapp.Locale) bool {
+	candidates = filter(candidates, localeFile.Code, fmt.Sprintf("code %q", localeFile.Code), func(cand *phraseapp.Locale) bool {
 		return cand.Code == localeFile.Code
 	})
 
+	candidates = filter(candidates, localeFile.ID, fmt.Sprintf("ID %q", localeFile.ID), func(cand *phraseapp.Locale) bool {
+		return cand.ID == localeFile.ID
+	})
+
+	transformed := []string{}
+	for placeholder := range localeFile.transformed {
+		transformed = append(transformed, placeholder)
+	}
+	sort.Strings(transformed)
+
+	for _, placeholder := range transformed {
+		value := localeFile.transformed[placeholder]
+		name, transforms := placeholders.Parse(placeholder)
+		candidates = filter(candidates, value, fmt.Sprintf("<%s> %q", placeholder, value), func(cand *phraseapp.Locale) bool {
+			var field string
+			switch name {
+			case "locale_code":
+				field = source.LocaleMapping.local(cand.Code)
+			case "locale_name":
+				field = source.LocaleMapping.local(cand.Name)
+			case "locale_id":
+				field = cand.ID
+			default:
+				return true
+			}
+			return placeholders.Transform(field, transforms...) == value
+		})
+	}
+
 	// If no filter was applied the candidates list still contains all remote
 	// locales, while actually nothing matches.
-	if !filterApplied {
-		return nil
+	if len(filters) == 0 {
+		return nil, nil
 	}
 
 	switch len(candidates) {
 	case 0:
-		return nil
+		return nil, nil
 	case 1:
-		return candidates[0]
+		return candidates[0], nil
 	default:
-		// TODO I guess this should return an error, as this is a problem.
-		return candidates[0]
+		names := []string{}
+		for _, cand := range candidates {
+			names = append(names, fmt.Sprintf("%s (code: %s, id: %s)", cand.Name, cand.Code, cand.ID))
+		}
+		return nil, fmt.Errorf(
+			"%s matches %d remote locales by %s: %s\nPlease make the file pattern or locale_id of the source more specific.",
+			localeFile.RelPath(), len(candidates), strings.Join(filters, ", "), strings.Join(names, ", "),
+		)
 	}
 }
 
@@ -283,8 +721,15 @@ func (localeFile *LocaleFile) fillFromPath(path, pattern string) {
 				localeFile.Code = value
 			case "locale_name":
 				localeFile.Name = value
+			case "locale_id":
+				localeFile.ID = value
 			case "tag":
 				localeFile.Tag = value
+			default:
+				if localeFile.transformed == nil {
+					localeFile.transformed = map[string]string{}
+				}
+				localeFile.transformed[placeholder] = value
 			}
 		}
 	}
@@ -293,6 +738,35 @@ func (localeFile *LocaleFile) fillFromPath(path, pattern string) {
 	fillFrom(pathEnd, patternEnd)
 }
 
+// transformedLocale describes the values of all transformed locale
+// placeholders in the path of the locale file.
+func (localeFile *LocaleFile) transformedLocale() []string {
+	values := []string{}
+	for placeholder, value := range localeFile.transformed {
+		if name, _ := placeholders.Parse(placeholder); strings.HasPrefix(name, "locale_") {
+			values = append(values, fmt.Sprintf("<%s> %q", placeholder, value))
+		}
+	}
+	sort.Strings(values)
+	return values
+}
+
+// hasUnresolvedLocale returns true if the locale of the file is only given by
+// transformed placeholders, which don't match any remote locale. The file
+// would be uploaded without a locale otherwise, as the locale to create
+// isn't known either.
+func (localeFile *LocaleFile) hasUnresolvedLocale(source *Source) bool {
+	switch {
+	case localeFile.ID != "" || localeFile.Code != "" || localeFile.Name != "":
+		return false
+	case source.Params != nil && source.Params.LocaleID != nil:
+		return false
+	case source.Format != nil && source.Format.IncludesLocaleInformation:
+		return false
+	}
+	return len(localeFile.transformedLocale()) > 0
+}
+
 func (localeFile *LocaleFile) shouldCreateLocale(source *Source) bool {
 	if localeFile.ExistsRemote {
 		return false
@@ -309,7 +783,10 @@ func (localeFile *LocaleFile) shouldCreateLocale(source *Source) bool {
 	return (localeFile.Name != "" || localeFile.Code != "")
 }
 
-func getUploadResult(client *phraseapp.Client, projectID string, upload *phraseapp.Upload) (result string, err error) {
+// getUploadResult polls the upload until it was processed and returns its
+// final state. Every polled state is passed to onPoll. An error is returned if
+// processing takes longer than timeout, unless timeout is 0.
+func getUploadResult(client *phraseapp.Client, projectID string, upload *phraseapp.Upload, timeout time.Duration, onPoll func(*phraseapp.Upload)) (*phraseapp.Upload, error) {
 	b := &backoff.Backoff{
 		Min:    500 * time.Millisecond,
 		Max:    10 * time.Second,
@@ -317,13 +794,34 @@ func getUploadResult(client *phraseapp.Client, projectID string, upload *phrasea
 		Jitter: true,
 	}
 
-	for ; result != "success" && result != "error"; result = upload.State {
-		time.Sleep(b.Duration())
+	var deadline time.Time
+	if timeout > 0 {
+		deadline = time.Now().Add(timeout)
+	}
+
+	for {
+		wait := b.Duration()
+		if !deadline.IsZero() {
+			remaining := deadline.Sub(time.Now())
+			if remaining <= 0 {
+				return nil, fmt.Errorf("upload %s was not processed within %s", upload.ID, timeout)
+			}
+			if wait > remaining {
+				wait = remaining
+			}
+		}
+
+		time.Sleep(wait)
+		var err error
 		upload, err = client.UploadShow(projectID, upload.ID)
 		if err != nil {
-			break
+			return nil, err
+		}
+		if onPoll != nil {
+			onPoll(upload)
+		}
+		if upload.State == "success" || upload.State == "error" {
+			return upload, nil
 		}
 	}
-
-	return
 }
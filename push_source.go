@@ -16,7 +16,8 @@ func SourcesFromConfig(config phraseapp.Config) (Sources, error) {
 	}
 
 	tmp := struct {
-		Sources Sources
+		Sources       Sources
+		LocaleMapping LocaleMapping `yaml:"locale_mapping"`
 	}{}
 	err := yaml.Unmarshal(config.Sources, &tmp)
 	if err != nil {
@@ -47,6 +48,10 @@ func SourcesFromConfig(config phraseapp.Config) (Sources, error) {
 				source.Params.FileFormat = &fileFormat
 			}
 		}
+		source.LocaleMapping = tmp.LocaleMapping.merge(source.LocaleMapping)
+		if err := source.LocaleMapping.validate(); err != nil {
+			return nil, err
+		}
 		validSources = append(validSources, source)
 	}
 
@@ -57,6 +62,26 @@ func SourcesFromConfig(config phraseapp.Config) (Sources, error) {
 	return validSources, nil
 }
 
+// PushSettings contains the options of the push section in the config file
+// that apply to all sources.
+type PushSettings struct {
+	TransferSettings `yaml:",inline"`
+
+	// see PushCommand.StrictLocaleMatching
+	StrictLocaleMatching bool `yaml:"strict_locale_matching"`
+}
+
+func PushSettingsFromConfig(config phraseapp.Config) (*PushSettings, error) {
+	settings := new(PushSettings)
+	if err := yaml.Unmarshal(config.Sources, settings); err != nil {
+		return nil, err
+	}
+	if err := settings.validate("push"); err != nil {
+		return nil, err
+	}
+	return settings, nil
+}
+
 type Sources []*Source
 
 func (sources Sources) Validate() error {
@@ -69,14 +94,23 @@ func (sources Sources) Validate() error {
 }
 
 type Source struct {
+	Name        string
 	File        string
 	ProjectID   string
 	AccessToken string
+	Host        string
 	FileFormat  string
 	Params      *phraseapp.UploadParams
 
 	RemoteLocales []*phraseapp.Locale
 	Format        *phraseapp.Format
+
+	// tokens used in the path instead of locale codes and names
+	LocaleMapping LocaleMapping
+
+	// don't match locales partially by the name given by a locale_id param
+	// with <locale_code> placeholder
+	strictLocaleMatching bool
 }
 
 func (source *Source) GetLocaleID() string {
@@ -102,7 +136,7 @@ func (source *Source) CheckPreconditions() error {
 	}
 
 	duplicatedPlaceholders := []string{}
-	for _, name := range []string{"<locale_name>", "<locale_code>", "<tag>"} {
+	for _, name := range []string{"<locale_name>", "<locale_code>", "<locale_id>", "<tag>"} {
 		if strings.Count(source.File, name) > 1 {
 			duplicatedPlaceholders = append(duplicatedPlaceholders, name)
 		}
@@ -130,17 +164,25 @@ func (source *Source) CheckPreconditions() error {
 
 func (src *Source) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	m := map[string]interface{}{}
+	var localeMapping map[string]interface{}
 	err := phraseapp.ParseYAMLToMap(unmarshal, map[string]interface{}{
-		"file":         &src.File,
-		"project_id":   &src.ProjectID,
-		"access_token": &src.AccessToken,
-		"file_format":  &src.FileFormat,
-		"params":       &m,
+		"name":           &src.Name,
+		"file":           &src.File,
+		"project_id":     &src.ProjectID,
+		"access_token":   &src.AccessToken,
+		"host":           &src.Host,
+		"file_format":    &src.FileFormat,
+		"locale_mapping": &localeMapping,
+		"params":         &m,
 	})
 	if err != nil {
 		return err
 	}
 
+	if src.LocaleMapping, err = parseLocaleMapping("locale_mapping", localeMapping); err != nil {
+		return err
+	}
+
 	src.Params = new(phraseapp.UploadParams)
 	return src.Params.ApplyValuesFromMap(m)
 }
@@ -152,6 +194,47 @@ func (sources Sources) ProjectIds() []string {
 	}
 	return projectIds
 }
+
+// selected returns the sources given by name or position.
+func (sources Sources) selected(selectors []string) (Sources, error) {
+	names := []string{}
+	for _, source := range sources {
+		names = append(names, source.Name)
+	}
+
+	indexes, err := selectEntries("source", selectors, names)
+	if err != nil {
+		return nil, err
+	}
+
+	selected := Sources{}
+	for _, i := range indexes {
+		selected = append(selected, sources[i])
+	}
+	return selected, nil
+}
+
+// tags returns the tags configured in the params of the source.
+func (source *Source) tags() []string {
+	if source.Params == nil || source.Params.Tags == nil {
+		return nil
+	}
+	return splitTags(*source.Params.Tags)
+}
+
+func (sources Sources) Clients(client *phraseapp.Client) []*phraseapp.Client {
+	clients := []*phraseapp.Client{}
+	for _, source := range sources {
+		clients = append(clients, source.client(client))
+	}
+	return clients
+}
+
+// client returns the client to use for the source, which differs from the
+// given one if the source has its own access token or host.
+func (source *Source) client(client *phraseapp.Client) *phraseapp.Client {
+	return withCredentials(client, source.AccessToken, source.Host)
+}
 func (source *Source) uploadFile(client *phraseapp.Client, localeFile *LocaleFile) (*phraseapp.Upload, error) {
 	if Debug {
 		fmt.Fprintln(os.Stdout, "Source file pattern:", source.File)
@@ -1,6 +1,9 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
@@ -9,7 +12,9 @@ import (
 	"path"
 	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/phrase/phraseapp-client/internal/paths"
 	"github.com/phrase/phraseapp-client/internal/placeholders"
@@ -154,7 +159,10 @@ func TestGetRemoteLocaleForLocaleFile(t *testing.T) {
 		ID:   "",
 		Path: "",
 	}
-	locale := source.getRemoteLocaleForLocaleFile(localeFile)
+	locale, err := source.getRemoteLocaleForLocaleFile(localeFile)
+	if err != nil {
+		t.Fatal(err)
+	}
 	if locale.Name != localeFile.Name {
 		t.Errorf("Expected LocaleName to equal '%s' but was '%s'", "ennglish", localeFile.Name)
 		t.Fail()
@@ -520,8 +528,10 @@ func TestRemoteLocaleForLocaleFile(t *testing.T) {
 		lf := new(LocaleFile)
 		lf.Name = tti.name
 		lf.Code = tti.code
-		r := src.getRemoteLocaleForLocaleFile(lf)
+		r, err := src.getRemoteLocaleForLocaleFile(lf)
 		switch {
+		case err != nil:
+			t.Errorf("%d: unexpected error %s", i, err)
 		case tti.expLocales == nil && r != nil:
 			t.Errorf("%d: didn't expect an locale, got %q", i, r.ID)
 		case tti.expLocales != nil && r == nil:
@@ -951,3 +961,334 @@ func (pattern *Pattern) TestPattern(t *testing.T, idx int) {
 		t.Errorf("Expected LocaleName to equal '%s' but was '%s' Pattern: %d", pattern.ExpectedName, localeFile.Name, idx+1)
 	}
 }
+
+// processingHandler accepts uploads and reports them as processed with an
+// error for the de locale and successfully for all others.
+type processingHandler struct {
+	stuck bool
+}
+
+func (ph *processingHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	if req.Method == "POST" {
+		if err := req.ParseMultipartForm(1 << 20); err != nil {
+			resp.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		resp.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(resp, `{"id": %q, "state": "enqueued"}`, req.MultipartForm.Value["locale_id"][0])
+		return
+	}
+
+	id := path.Base(req.URL.Path)
+	switch {
+	case ph.stuck:
+		fmt.Fprintf(resp, `{"id": %q, "state": "processing"}`, id)
+	case id == "de-locale-id":
+		fmt.Fprintf(resp, `{"id": %q, "state": "error"}`, id)
+	default:
+		fmt.Fprintf(resp, `{"id": %q, "state": "success", "summary": {"translation_keys_created": 2, "translations_updated": 3}}`, id)
+	}
+}
+
+func TestPushWait(t *testing.T) {
+	d := setupFiles(t, "en.yml", "de.yml")
+	defer os.RemoveAll(d)
+
+	defer func(dir string) { configDir = dir }(configDir)
+	configDir = d
+
+	ph := new(processingHandler)
+	srv := httptest.NewServer(ph)
+	defer srv.Close()
+
+	c, err := newClient(phraseapp.Credentials{Host: srv.URL, Token: "some_token"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	source := getBaseSource()
+	source.File = filepath.Join(d, "<locale_code>.yml")
+	source.Format = new(phraseapp.Format)
+
+	buf := new(bytes.Buffer)
+	cmd := &PushCommand{Wait: true, Parallel: 2, Output: outputJSON, events: newEventWriter(buf)}
+	err = cmd.push(c, Sources{source})
+	if err == nil || !strings.Contains(err.Error(), "de.yml: processing of upload de-locale-id failed") || strings.Contains(err.Error(), "en.yml") {
+		t.Errorf("expected processing error for de.yml only, got %v", err)
+	}
+
+	events := decodeEvents(t, buf)
+	if len(events) != 2 {
+		t.Fatalf("expected 2 events, got %d", len(events))
+	}
+	if e := events[0]; e.Event != eventFailed || e.UploadState != "error" {
+		t.Errorf("expected de.yml to fail processing, got %+v", e)
+	}
+	if e := events[1]; e.Event != eventUploaded || e.UploadState != "success" || e.Summary.TranslationKeysCreated != 2 {
+		t.Errorf("expected en.yml to be processed, got %+v", e)
+	}
+
+	ph.stuck = true
+	timeout := 200 * time.Millisecond
+	cmd = &PushCommand{Wait: true, Force: true, Parallel: 2, waitTimeout: timeout, events: newEventWriter(ioutil.Discard)}
+	start := time.Now()
+	err = cmd.push(c, Sources{source})
+	if err == nil || !strings.Contains(err.Error(), "was not processed within 200ms") {
+		t.Errorf("expected timeout error, got %v", err)
+	}
+	// both uploads are awaited at the same time
+	if d := time.Since(start); d >= 2*timeout {
+		t.Errorf("expected uploads to time out after %s, took %s", timeout, d)
+	}
+}
+
+func TestPrintUploadSummary(t *testing.T) {
+	jobs := []*pushJob{}
+	for _, code := range []string{"de", "en", "fr"} {
+		jobs = append(jobs, &pushJob{localeFile: &LocaleFile{Path: filepath.Join(os.TempDir(), code+".yml")}})
+	}
+	jobs[0].upload = &phraseapp.Upload{State: "error"}
+	jobs[1].upload = &phraseapp.Upload{State: "success", Summary: phraseapp.SummaryType{TranslationKeysCreated: 2, TranslationsUpdated: 3}}
+	jobs[2].upload = &phraseapp.Upload{State: "processing"}
+
+	buf := new(bytes.Buffer)
+	printUploadSummary(buf, jobs)
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("expected header, two files and total, got:\n%s", buf)
+	}
+	for i, exp := range [][]string{
+		{"de.yml", "error", "0", "0", "0", "0", "0"},
+		{"en.yml", "success", "2", "0", "3", "0", "0"},
+		{"TOTAL", "2", "file(s)", "2", "0", "3", "0", "0"},
+	} {
+		got := strings.Fields(lines[i+1])
+		got[0] = filepath.Base(got[0])
+		if strings.Join(got, " ") != strings.Join(exp, " ") {
+			t.Errorf("expected row %v, got %v", exp, got)
+		}
+	}
+}
+
+// cleanupHandler handles uploads like processingHandler and lists a single
+// key as unmentioned in them, which it deletes on request.
+type cleanupHandler struct {
+	processingHandler
+
+	mu          sync.Mutex
+	listQueries []string
+	deleted     bool
+}
+
+func (ch *cleanupHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	if !strings.HasSuffix(req.URL.Path, "/keys") {
+		ch.processingHandler.ServeHTTP(resp, req)
+		return
+	}
+
+	var params struct{ Q string }
+	if err := json.NewDecoder(req.Body).Decode(&params); err != nil {
+		resp.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+
+	switch req.Method {
+	case "GET":
+		ch.listQueries = append(ch.listQueries, params.Q)
+		if ch.deleted {
+			fmt.Fprint(resp, `[]`)
+		} else {
+			fmt.Fprint(resp, `[{"id": "key-id", "name": "obsolete"}]`)
+		}
+	case "DELETE":
+		ch.deleted = params.Q == "ids:key-id"
+		fmt.Fprint(resp, `{"records_affected": 1}`)
+	}
+}
+
+func TestPushCleanup(t *testing.T) {
+	d := setupFiles(t, "en.yml", "de.yml")
+	defer os.RemoveAll(d)
+
+	defer func(dir string) { configDir = dir }(configDir)
+	configDir = d
+
+	ch := new(cleanupHandler)
+	srv := httptest.NewServer(ch)
+	defer srv.Close()
+
+	c, err := newClient(phraseapp.Credentials{Host: srv.URL, Token: "some_token"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	source := getBaseSource()
+	source.File = filepath.Join(d, "en.yml")
+	source.Format = new(phraseapp.Format)
+	source.Params.LocaleID = &getBaseLocales()[0].ID
+
+	// processing of the de locale fails, so its project must not be cleaned up
+	failing := getBaseSource()
+	failing.ProjectID = "other-project-id"
+	failing.File = filepath.Join(d, "<locale_code>.yml")
+	failing.Format = new(phraseapp.Format)
+
+	buf := new(bytes.Buffer)
+	cmd := &PushCommand{Wait: true, Cleanup: true, Confirm: true, events: newEventWriter(buf)}
+	err = cmd.push(c, Sources{source, failing})
+	if err == nil || !strings.Contains(err.Error(), "Skipped cleanup of project other-project-id") {
+		t.Errorf("expected cleanup of the failing project to be skipped, got %v", err)
+	}
+
+	if len(ch.listQueries) == 0 || ch.listQueries[0] != "unmentioned_in_upload:en-locale-id" {
+		t.Errorf("expected keys unmentioned in the upload of en.yml to be listed, got %v", ch.listQueries)
+	}
+	if !ch.deleted {
+		t.Errorf("expected the unmentioned key to be deleted")
+	}
+
+	events := decodeEvents(t, buf)
+	e := events[len(events)-1]
+	if e.Event != eventCleanedUp || e.ProjectID != "project-id" || e.DeletedKeys == nil || *e.DeletedKeys != 1 {
+		t.Errorf("expected cleanup event for project-id, got %+v", e)
+	}
+}
+
+func TestSourceLocaleFilesTransformedPlaceholders(t *testing.T) {
+	d, err := ioutil.TempDir("", "phrase-push-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(d)
+
+	for _, file := range []string{"project-id/en_us.yml", "project-id/de.yml", "other-project/fr.yml"} {
+		path := filepath.Join(d, file)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte("a: b"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	source := getBaseSource()
+	source.File = filepath.Join(d, "<project_id>", "<locale_code|underscore|lower>.yml")
+	source.RemoteLocales = []*phraseapp.Locale{
+		&phraseapp.Locale{ID: "en-us-locale-id", Code: "en-US", Name: "english"},
+		&phraseapp.Locale{ID: "de-locale-id", Code: "de", Name: "german"},
+		&phraseapp.Locale{ID: "fr-locale-id", Code: "fr", Name: "french"},
+	}
+
+	localeFiles, err := source.LocaleFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ids := []string{}
+	for _, lf := range localeFiles {
+		if !lf.ExistsRemote {
+			t.Errorf("expected %s to match a remote locale", lf.Path)
+		}
+		ids = append(ids, lf.ID)
+	}
+	if strings.Join(ids, ",") != "de-locale-id,en-us-locale-id" {
+		t.Errorf("expected files of locales de and en-US, got %v", ids)
+	}
+}
+
+func TestSourceLocaleFilesUnresolvedTransformedPlaceholders(t *testing.T) {
+	d := setupFiles(t, "en.yml", "pt_br.yml")
+	defer os.RemoveAll(d)
+
+	source := getBaseSource()
+	source.File = filepath.Join(d, "<locale_code|underscore>.yml")
+
+	_, err := source.LocaleFiles()
+	if err == nil || !strings.Contains(err.Error(), `pt_br.yml matches no remote locale by <locale_code|underscore> "pt_br"`) {
+		t.Errorf("expected an error for the unknown locale of pt_br.yml, got %v", err)
+	}
+
+	// the locale_id param tells which locale to upload to
+	localeID := "en-locale-id"
+	source.Params.LocaleID = &localeID
+	if _, err := source.LocaleFiles(); err != nil {
+		t.Errorf("didn't expect an error with locale_id param, got %s", err)
+	}
+}
+
+func TestSourceLocaleFilesLocaleMapping(t *testing.T) {
+	d, err := ioutil.TempDir("", "phrase-push-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(d)
+
+	for _, dir := range []string{"values-pt-rBR", "values-de"} {
+		if err := os.MkdirAll(filepath.Join(d, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(d, dir, "strings.xml"), []byte("<resources/>"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	source := getBaseSource()
+	source.File = filepath.Join(d, "values-<locale_code>", "strings.xml")
+	source.LocaleMapping = LocaleMapping{"pt-BR": "pt-rBR"}
+	source.RemoteLocales = []*phraseapp.Locale{
+		&phraseapp.Locale{ID: "pt-br-locale-id", Code: "pt-BR", Name: "portuguese"},
+		&phraseapp.Locale{ID: "de-locale-id", Code: "de", Name: "german"},
+	}
+
+	localeFiles, err := source.LocaleFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	codes := map[string]string{}
+	for _, lf := range localeFiles {
+		codes[filepath.Base(filepath.Dir(lf.Path))] = lf.Code + " " + lf.ID
+	}
+	for dir, exp := range map[string]string{"values-pt-rBR": "pt-BR pt-br-locale-id", "values-de": "de de-locale-id"} {
+		if codes[dir] != exp {
+			t.Errorf("expected %s to be resolved to %q, got %q", dir, exp, codes[dir])
+		}
+	}
+}
+
+func TestRemoteLocaleForLocaleFileAmbiguous(t *testing.T) {
+	src := getBaseSource()
+	src.RemoteLocales = []*phraseapp.Locale{
+		&phraseapp.Locale{ID: "en-locale-id", Name: "en", Code: "en"},
+		&phraseapp.Locale{ID: "en-gb-locale-id", Name: "en-GB", Code: "en"},
+	}
+	lf := &LocaleFile{Code: "en", Path: "en.yml"}
+
+	_, err := src.getRemoteLocaleForLocaleFile(lf)
+	expect := `matches 2 remote locales by code "en": en (code: en, id: en-locale-id), en-GB (code: en, id: en-gb-locale-id)`
+	if err == nil || !strings.Contains(err.Error(), expect) {
+		t.Errorf("expected error containing %q, got %v", expect, err)
+	}
+
+	// the name given by locale_id is matched partially unless strict
+	lid := "<locale_code>"
+	src.Params.LocaleID = &lid
+	src.RemoteLocales[1].Code = "en-GB"
+	if _, err := src.getRemoteLocaleForLocaleFile(lf); err != nil {
+		t.Errorf("unexpected error %s", err)
+	}
+
+	lf = &LocaleFile{Code: "en-G", Path: "en-G.yml"}
+	src.RemoteLocales[1].Code = "en-G"
+	if r, err := src.getRemoteLocaleForLocaleFile(lf); err != nil || r == nil || r.ID != "en-gb-locale-id" {
+		t.Errorf("expected partial match of locale en-GB, got %v, %v", r, err)
+	}
+
+	src.strictLocaleMatching = true
+	if r, err := src.getRemoteLocaleForLocaleFile(lf); err != nil || r != nil {
+		t.Errorf("expected no locale to match strictly, got %v, %v", r, err)
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jpillora/backoff"
+)
+
+// DefaultMaxRetries is the number of times a failed request is retried if
+// neither the --max-retries option nor the retry config key is set.
+const DefaultMaxRetries = 3
+
+// maxRateLimitWait is the longest time to wait for the rate limit to reset.
+// If the reset lies further in the future the request fails right away.
+const maxRateLimitWait = 5 * time.Minute
+
+const concurrencyLimitMessage = "Concurrency limit exceeded"
+
+// retryTransport retries requests that failed because of the API rate limit
+// or transient server and connection errors. Requests rejected by the rate
+// limit are retried regardless of their method, as they were never processed.
+// Everything else is only retried for idempotent requests and uploads.
+type retryTransport struct {
+	base       http.RoundTripper
+	maxRetries int
+	backoff    *backoff.Backoff
+}
+
+func newRetryTransport(base http.RoundTripper, maxRetries int) *retryTransport {
+	return &retryTransport{
+		base:       base,
+		maxRetries: maxRetries,
+		// Min, Max and Factor must be set for ForAttempt to be safe for
+		// concurrent use.
+		backoff: &backoff.Backoff{
+			Min:    500 * time.Millisecond,
+			Max:    30 * time.Second,
+			Factor: 2,
+			Jitter: true,
+		},
+	}
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		r, err := rewindRequest(req, attempt)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := t.base.RoundTrip(r)
+		if attempt >= t.maxRetries || (req.Body != nil && req.GetBody == nil) {
+			return resp, err
+		}
+
+		wait, retry := t.retryAfter(req, resp, err, attempt)
+		if !retry {
+			return resp, err
+		}
+
+		if resp != nil {
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		if Debug {
+			fmt.Fprintf(os.Stderr, "Retrying %s %s in %s (attempt %d of %d)\n", req.Method, req.URL.Path, wait, attempt+1, t.maxRetries)
+		}
+		time.Sleep(wait)
+	}
+}
+
+// retryAfter decides whether the request should be retried and how long to
+// wait before doing so.
+func (t *retryTransport) retryAfter(req *http.Request, resp *http.Response, err error, attempt int) (time.Duration, bool) {
+	switch {
+	case err != nil:
+		return t.backoff.ForAttempt(float64(attempt)), isRetryableMethod(req) && isTransientError(err)
+	case resp.StatusCode == http.StatusTooManyRequests:
+		return rateLimitWait(resp, t.backoff.ForAttempt(float64(attempt)))
+	case resp.StatusCode >= 500:
+		return t.backoff.ForAttempt(float64(attempt)), isRetryableMethod(req)
+	default:
+		return 0, false
+	}
+}
+
+// rateLimitWait returns how long to wait before a request rejected with 429
+// can be retried. If too many requests were sent in parallel, fallback is
+// used. Otherwise the reset time of the rate limit is honoured.
+func rateLimitWait(resp *http.Response, fallback time.Duration) (time.Duration, bool) {
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	// the body must stay readable in case the response is returned
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return 0, false
+	}
+
+	if strings.TrimSpace(string(body)) == concurrencyLimitMessage {
+		return fallback, true
+	}
+
+	reset, err := strconv.ParseInt(resp.Header.Get("X-Rate-Limit-Reset"), 10, 64)
+	if err != nil {
+		return fallback, true
+	}
+
+	wait := time.Unix(reset, 0).Sub(time.Now()) + time.Second
+	switch {
+	case wait > maxRateLimitWait:
+		return 0, false
+	case wait < fallback:
+		return fallback, true
+	}
+
+	fmt.Fprintf(os.Stderr, "Rate limit exceeded, waiting %d seconds for it to reset.\n", int64(wait.Seconds()))
+	return wait, true
+}
+
+// rewindRequest returns req for the first attempt. For later attempts a copy
+// with a fresh body is returned, as the body was consumed by the previous one.
+func rewindRequest(req *http.Request, attempt int) (*http.Request, error) {
+	if attempt == 0 || req.Body == nil || req.GetBody == nil {
+		return req, nil
+	}
+
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, err
+	}
+
+	r := new(http.Request)
+	*r = *req
+	r.Body = body
+	return r, nil
+}
+
+func isRetryableMethod(req *http.Request) bool {
+	switch req.Method {
+	case "GET", "HEAD", "PUT", "DELETE", "OPTIONS":
+		return true
+	case "POST":
+		// Processing the same file twice yields the same result, so
+		// uploads can be retried safely.
+		return strings.HasSuffix(req.URL.Path, "/uploads")
+	default:
+		return false
+	}
+}
+
+func isTransientError(err error) bool {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return true
+	}
+	_, ok := err.(net.Error)
+	return ok
+}
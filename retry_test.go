@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type flakyHandler struct {
+	failures int
+	status   int
+	body     string
+	requests int
+	bodies   []string
+}
+
+func (fh *flakyHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	fh.requests++
+	b, _ := ioutil.ReadAll(req.Body)
+	fh.bodies = append(fh.bodies, string(b))
+
+	if fh.requests <= fh.failures {
+		resp.Header().Set("X-Rate-Limit-Reset", fmt.Sprintf("%d", time.Now().Unix()))
+		resp.WriteHeader(fh.status)
+		fmt.Fprint(resp, fh.body)
+		return
+	}
+	fmt.Fprint(resp, "ok")
+}
+
+func newTestRetryTransport(maxRetries int) *retryTransport {
+	tr := newRetryTransport(http.DefaultTransport, maxRetries)
+	tr.backoff.Min = time.Millisecond
+	tr.backoff.Max = 5 * time.Millisecond
+	return tr
+}
+
+func TestRetryTransport(t *testing.T) {
+	tt := []struct {
+		method     string
+		path       string
+		status     int
+		body       string
+		failures   int
+		maxRetries int
+		expStatus  int
+		expCalls   int
+	}{
+		{"GET", "/locales", 503, "", 2, 3, 200, 3},
+		{"GET", "/locales", 503, "", 5, 3, 503, 4},
+		{"GET", "/locales", 503, "", 1, 0, 503, 1},
+		{"POST", "/v2/projects/p/uploads", 502, "", 1, 3, 200, 2},
+		{"POST", "/v2/projects/p/locales", 502, "", 1, 3, 502, 1},
+		{"POST", "/v2/projects/p/locales", 429, "Concurrency limit exceeded", 2, 3, 200, 3},
+		{"PATCH", "/v2/projects/p/keys/k", 429, "", 1, 3, 200, 2},
+		{"GET", "/locales", 404, "", 1, 3, 404, 1},
+	}
+
+	for _, tti := range tt {
+		fh := &flakyHandler{failures: tti.failures, status: tti.status, body: tti.body}
+		srv := httptest.NewServer(fh)
+
+		client := &http.Client{Transport: newTestRetryTransport(tti.maxRetries)}
+		req, err := http.NewRequest(tti.method, srv.URL+tti.path, strings.NewReader("payload"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp, err := client.Do(req)
+		srv.Close()
+		if err != nil {
+			t.Errorf("%s %s: didn't expect an error, got: %s", tti.method, tti.path, err)
+			continue
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != tti.expStatus {
+			t.Errorf("%s %s: expected status %d, got %d", tti.method, tti.path, tti.expStatus, resp.StatusCode)
+		}
+		if fh.requests != tti.expCalls {
+			t.Errorf("%s %s: expected %d requests, got %d", tti.method, tti.path, tti.expCalls, fh.requests)
+		}
+		for _, body := range fh.bodies {
+			if body != "payload" {
+				t.Errorf("%s %s: expected every attempt to send the body, got %q", tti.method, tti.path, body)
+			}
+		}
+	}
+}
+
+func TestRetryTransportKeepsRateLimitBody(t *testing.T) {
+	fh := &flakyHandler{failures: 5, status: 429, body: "Concurrency limit exceeded"}
+	srv := httptest.NewServer(fh)
+	defer srv.Close()
+
+	client := &http.Client{Transport: newTestRetryTransport(1)}
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("didn't expect an error, got: %s", err)
+	}
+	defer resp.Body.Close()
+
+	b, _ := ioutil.ReadAll(resp.Body)
+	if string(b) != "Concurrency limit exceeded" {
+		t.Errorf("expected the body of the last response to be readable, got %q", b)
+	}
+}
@@ -1,18 +1,53 @@
 package main
 
-import "github.com/phrase/phraseapp-go/phraseapp"
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/phrase/phraseapp-go/phraseapp"
+)
 
 var Debug bool
 
+// TransferSettings contains the options shared by the push and pull sections
+// in the config file.
+type TransferSettings struct {
+	Parallel int
+	Retry    *int
+}
+
+func (settings *TransferSettings) validate(section string) error {
+	if settings.Parallel < 0 {
+		return fmt.Errorf("%s.parallel must not be negative, got %d", section, settings.Parallel)
+	}
+	if settings.Retry != nil && *settings.Retry < 0 {
+		return fmt.Errorf("%s.retry must not be negative, got %d", section, *settings.Retry)
+	}
+	return nil
+}
+
+// MaxRetries returns the number of times failed requests should be retried.
+func (settings *TransferSettings) MaxRetries() *int {
+	if settings.Retry != nil {
+		return settings.Retry
+	}
+	maxRetries := DefaultMaxRetries
+	return &maxRetries
+}
+
 type ProjectLocales interface {
 	ProjectIds() []string
+	// Clients returns the client to use for every project, in the same order
+	// as ProjectIds.
+	Clients(client *phraseapp.Client) []*phraseapp.Client
 }
 
 func LocalesForProjects(client *phraseapp.Client, projectLocales ProjectLocales) (map[string][]*phraseapp.Locale, error) {
 	projectIdToLocales := map[string][]*phraseapp.Locale{}
-	for _, pid := range projectLocales.ProjectIds() {
+	clients := projectLocales.Clients(client)
+	for i, pid := range projectLocales.ProjectIds() {
 		if _, ok := projectIdToLocales[pid]; !ok {
-			remoteLocales, err := RemoteLocales(client, pid)
+			remoteLocales, err := RemoteLocales(clients[i], pid)
 			if err != nil {
 				return nil, err
 			}
@@ -40,3 +75,30 @@ func RemoteLocales(client *phraseapp.Client, projectId string) ([]*phraseapp.Loc
 	}
 	return result, nil
 }
+
+// RemoteTags returns the names of all tags of the project.
+func RemoteTags(client *phraseapp.Client, projectId string) ([]string, error) {
+	result := []string{}
+	for page := 1; ; page++ {
+		tags, err := client.TagsList(projectId, page, 25)
+		if err != nil {
+			return nil, err
+		}
+		for _, tag := range tags {
+			result = append(result, tag.Name)
+		}
+		if len(tags) < 25 {
+			return result, nil
+		}
+	}
+}
+
+// pathNextToConfig returns the absolute path of a file with the given name in
+// the directory of the config file, or in the working directory for the config
+// in the home directory.
+func pathNextToConfig(name string) (string, error) {
+	if configDir != "" {
+		return filepath.Join(configDir, name), nil
+	}
+	return filepath.Abs(name)
+}
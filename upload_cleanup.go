@@ -2,6 +2,8 @@ package main
 
 import (
 	"fmt"
+	"io"
+	"os"
 	"sort"
 	"strings"
 
@@ -11,8 +13,13 @@ import (
 
 type UploadCleanupCommand struct {
 	phraseapp.Config
-	ID      string `cli:"arg required"`
-	Confirm bool   `cli:"opt --confirm desc='Don’t ask for confirmation'"`
+	ID        string `cli:"arg required"`
+	Confirm   bool   `cli:"opt --confirm desc='Don’t ask for confirmation'"`
+	DryRun    bool   `cli:"opt --dry-run desc='Only list the keys that would be deleted'"`
+	Backup    string `cli:"opt --backup desc='Save the deleted keys with their translations to this file, see upload/cleanup-restore'"`
+	ProjectID string `cli:"opt --project-id desc='Project to clean up, defaults to the project of the config'"`
+	PerPage   int    `cli:"opt --per-page desc='Number of keys to fetch per request (max 100)' default=25"`
+	BatchSize int    `cli:"opt --batch-size desc='Number of keys to delete per request' default=25"`
 }
 
 func (cmd *UploadCleanupCommand) Run() error {
@@ -26,61 +33,164 @@ func (cmd *UploadCleanupCommand) Run() error {
 }
 
 func UploadCleanup(client *phraseapp.Client, cmd *UploadCleanupCommand) error {
-	q := "unmentioned_in_upload:" + cmd.ID
-	params := &phraseapp.KeysListParams{Q: &q}
+	projectID := cmd.ProjectID
+	if projectID == "" {
+		projectID = cmd.Config.DefaultProjectID
+	}
+	if projectID == "" {
+		return fmt.Errorf("No project given, please specify --project-id or a project_id in your config")
+	}
+
+	opts := cleanupOptions{
+		Confirm:   cmd.Confirm,
+		DryRun:    cmd.DryRun,
+		Backup:    cmd.Backup,
+		PerPage:   cmd.PerPage,
+		BatchSize: cmd.BatchSize,
+	}
+	if err := opts.validate(); err != nil {
+		return err
+	}
+
+	_, err := uploadCleanup(client, projectID, []string{cmd.ID}, opts, os.Stdout)
+	return err
+}
+
+// cleanupOptions control how uploadCleanup deletes keys.
+type cleanupOptions struct {
+	// don't ask the user before deleting keys
+	Confirm bool
+	// only list the keys, without deleting them
+	DryRun bool
+	// path of a file to save the keys and their translations to before they
+	// are deleted
+	Backup string
+	// number of keys fetched and deleted per request, 0 uses the default
+	PerPage   int
+	BatchSize int
+}
+
+const defaultCleanupPageSize = 25
 
-	var err error
-	page := 1
+func (opts cleanupOptions) validate() error {
+	if opts.PerPage < 0 || opts.PerPage > 100 {
+		return fmt.Errorf("--per-page must be between 1 and 100, got %d", opts.PerPage)
+	}
+	if opts.BatchSize < 0 {
+		return fmt.Errorf("--batch-size must be positive, got %d", opts.BatchSize)
+	}
+	return nil
+}
+
+func (opts cleanupOptions) perPage() int {
+	if opts.PerPage > 0 {
+		return opts.PerPage
+	}
+	return defaultCleanupPageSize
+}
+
+func (opts cleanupOptions) batchSize() int {
+	if opts.BatchSize > 0 {
+		return opts.BatchSize
+	}
+	return defaultCleanupPageSize
+}
 
-	keys, err := client.KeysList(cmd.Config.DefaultProjectID, page, 25, params)
+// uploadCleanup deletes all keys of the project that aren't mentioned in any
+// of the given uploads and returns the number of deleted keys. Unless confirm
+// is set, the user is asked before any keys are deleted.
+func uploadCleanup(client *phraseapp.Client, projectID string, uploadIDs []string, opts cleanupOptions, w io.Writer) (int64, error) {
+	// All keys are collected before deleting any, as deleting keys shifts the
+	// pages of the remaining ones.
+	keys, err := unmentionedKeys(client, projectID, uploadIDs, opts.perPage())
 	if err != nil {
-		return err
+		return 0, err
 	}
 
 	if len(keys) == 0 {
-		fmt.Println("There were no keys unmentioned in that upload.")
-		return nil
+		fmt.Fprintln(w, "There were no keys unmentioned in that upload.")
+		return 0, nil
 	}
 
-	for len(keys) != 0 {
-		ids := make([]string, len(keys), len(keys))
-		names := make([]string, len(keys), len(keys))
-		for i, key := range keys {
-			ids[i] = key.ID
-			names[i] = key.Name
+	names := make([]string, len(keys), len(keys))
+	for i, key := range keys {
+		names[i] = key.Name
+	}
+	sort.Strings(names)
+
+	if opts.DryRun {
+		fmt.Fprintln(w, "The following key(s) would be deleted from your project:")
+		fmt.Fprintln(w, strings.Join(names, "\n"))
+		return 0, nil
+	}
+
+	if !opts.Confirm {
+		fmt.Println("You are about to delete the following key(s) from your project:")
+		fmt.Println(strings.Join(names, "\n"))
+
+		confirmation := ""
+		err := prompt.WithDefault("Are you sure you want to continue? (y/n)", &confirmation, "n")
+		if err != nil {
+			return 0, err
+		}
+
+		if strings.ToLower(confirmation) != "y" {
+			fmt.Println("Clean up aborted")
+			return 0, nil
+		}
+	}
+
+	if opts.Backup != "" {
+		backup := newCleanupBackup(opts.Backup, projectID)
+		if err := backup.add(client, keys); err != nil {
+			return 0, fmt.Errorf("Error writing backup to %s: %s", backup.path, err)
 		}
+		fmt.Fprintf(w, "Saved the key(s) to %s.\n", backup.path)
+	}
 
-		if !cmd.Confirm {
-			fmt.Println("You are about to delete the following key(s) from your project:")
-			sort.Strings(names)
-			fmt.Println(strings.Join(names, "\n"))
-
-			confirmation := ""
-			err := prompt.WithDefault("Are you sure you want to continue? (y/n)", &confirmation, "n")
-			if err != nil {
-				return err
-			}
-
-			if strings.ToLower(confirmation) != "y" {
-				fmt.Println("Clean up aborted")
-				return nil
-			}
+	var deleted int64
+	for start := 0; start < len(keys); start += opts.batchSize() {
+		end := start + opts.batchSize()
+		if end > len(keys) {
+			end = len(keys)
+		}
+
+		ids := make([]string, 0, end-start)
+		for _, key := range keys[start:end] {
+			ids = append(ids, key.ID)
 		}
 
 		q := "ids:" + strings.Join(ids, ",")
-		affected, err := client.KeysDelete(cmd.Config.DefaultProjectID, &phraseapp.KeysDeleteParams{
+		affected, err := client.KeysDelete(projectID, &phraseapp.KeysDeleteParams{
 			Q: &q,
 		})
 
 		if err != nil {
-			return err
+			return deleted, err
 		}
 
-		fmt.Printf("%d key(s) successfully deleted.\n", affected.RecordsAffected)
-
-		page++
-		keys, err = client.KeysList(cmd.Config.DefaultProjectID, page, 25, params)
+		deleted += affected.RecordsAffected
+		fmt.Fprintf(w, "%d key(s) successfully deleted.\n", affected.RecordsAffected)
 	}
 
-	return nil
+	return deleted, nil
+}
+
+// unmentionedKeys returns all keys of the project not mentioned in any of the
+// given uploads.
+func unmentionedKeys(client *phraseapp.Client, projectID string, uploadIDs []string, perPage int) ([]*phraseapp.TranslationKey, error) {
+	q := "unmentioned_in_upload:" + strings.Join(uploadIDs, ",")
+	params := &phraseapp.KeysListParams{Q: &q}
+
+	result := []*phraseapp.TranslationKey{}
+	for page := 1; ; page++ {
+		keys, err := client.KeysList(projectID, page, perPage, params)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, keys...)
+		if len(keys) < perPage {
+			return result, nil
+		}
+	}
 }
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/phrase/phraseapp-go/phraseapp"
+)
+
+// unmentionedKeysHandler lists the keys it wasn't asked to delete yet, so
+// deleting keys shifts the pages of the remaining ones like the API does.
+type unmentionedKeysHandler struct {
+	mu        sync.Mutex
+	remaining []string
+	deletes   int
+}
+
+func (uh *unmentionedKeysHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	uh.mu.Lock()
+	defer uh.mu.Unlock()
+
+	switch req.Method {
+	case "GET":
+		page, _ := strconv.Atoi(req.URL.Query().Get("page"))
+		perPage, _ := strconv.Atoi(req.URL.Query().Get("per_page"))
+		keys := []*phraseapp.TranslationKey{}
+		for i := (page - 1) * perPage; i < page*perPage && i < len(uh.remaining); i++ {
+			keys = append(keys, &phraseapp.TranslationKey{ID: uh.remaining[i], Name: "name-" + uh.remaining[i]})
+		}
+		json.NewEncoder(resp).Encode(keys)
+	case "DELETE":
+		var params struct{ Q string }
+		json.NewDecoder(req.Body).Decode(&params)
+		ids := map[string]bool{}
+		for _, id := range strings.Split(strings.TrimPrefix(params.Q, "ids:"), ",") {
+			ids[id] = true
+		}
+
+		remaining := []string{}
+		for _, id := range uh.remaining {
+			if !ids[id] {
+				remaining = append(remaining, id)
+			}
+		}
+		uh.deletes++
+		fmt.Fprintf(resp, `{"records_affected": %d}`, len(uh.remaining)-len(remaining))
+		uh.remaining = remaining
+	}
+}
+
+func TestUploadCleanupDeletesAllPages(t *testing.T) {
+	uh := new(unmentionedKeysHandler)
+	for i := 0; i < 60; i++ {
+		uh.remaining = append(uh.remaining, fmt.Sprintf("key-%d", i))
+	}
+	srv := httptest.NewServer(uh)
+	defer srv.Close()
+
+	c, err := newClient(phraseapp.Credentials{Host: srv.URL, Token: "some_token"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts := cleanupOptions{Confirm: true, PerPage: 25, BatchSize: 40}
+	deleted, err := uploadCleanup(c, "project-id", []string{"upload-id"}, opts, ioutil.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if deleted != 60 || len(uh.remaining) != 0 {
+		t.Errorf("expected all 60 keys to be deleted, got %d deleted and %d remaining", deleted, len(uh.remaining))
+	}
+	if uh.deletes != 2 {
+		t.Errorf("expected 2 delete requests with a batch size of 40, got %d", uh.deletes)
+	}
+}
+
+func TestUploadCleanupProjectID(t *testing.T) {
+	cmd := &UploadCleanupCommand{ID: "upload-id", PerPage: 101}
+	if err := UploadCleanup(nil, cmd); err == nil || !strings.Contains(err.Error(), "No project given") {
+		t.Errorf("expected missing project error, got %v", err)
+	}
+
+	cmd.ProjectID = "project-id"
+	if err := UploadCleanup(nil, cmd); err == nil || !strings.Contains(err.Error(), "--per-page must be between 1 and 100") {
+		t.Errorf("expected per page error, got %v", err)
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const uploadStateFileName = ".phraseapp.state"
+
+// uploadState records the locale files that were uploaded successfully, so
+// that push can skip files that didn't change since. Uploads that weren't
+// waited for are recorded together with their ID, as it isn't known yet
+// whether processing them succeeds.
+type uploadState struct {
+	path string
+	mu   sync.Mutex
+
+	Uploads map[string]*uploadRecord `json:"uploads"`
+}
+
+// uploadRecord identifies the content of a locale file uploaded to a locale.
+type uploadRecord struct {
+	ProjectID string `json:"project_id"`
+	Locale    string `json:"locale"`
+	Hash      string `json:"hash"`
+	UploadID  string `json:"upload_id,omitempty"`
+}
+
+// matches returns true if both records describe the same upload, regardless
+// of whether its processing is still pending.
+func (record *uploadRecord) matches(other *uploadRecord) bool {
+	return record.ProjectID == other.ProjectID && record.Locale == other.Locale && record.Hash == other.Hash
+}
+
+// loadUploadState reads the state file at path. A missing file results in an
+// empty state.
+func loadUploadState(path string) (*uploadState, error) {
+	state := &uploadState{path: path, Uploads: map[string]*uploadRecord{}}
+
+	content, err := ioutil.ReadFile(path)
+	switch {
+	case os.IsNotExist(err):
+		return state, nil
+	case err != nil:
+		return nil, err
+	}
+
+	if err := json.Unmarshal(content, state); err != nil {
+		return nil, err
+	}
+	if state.Uploads == nil {
+		state.Uploads = map[string]*uploadRecord{}
+	}
+	return state, nil
+}
+
+func (state *uploadState) save() error {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	content, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(state.path, append(content, '\n'), 0644)
+}
+
+// key returns the project ID and the path of the locale file relative to the
+// state file, so the state stays valid when the project is checked out
+// somewhere else and the same file can be pushed to several projects.
+func (state *uploadState) key(source *Source, localeFile *LocaleFile) string {
+	rel, err := filepath.Rel(filepath.Dir(state.path), localeFile.Path)
+	if err != nil {
+		rel = localeFile.Path
+	}
+	return source.ProjectID + ":" + filepath.ToSlash(rel)
+}
+
+// lookup returns whether the locale file was already uploaded to the same
+// locale with the same content and parameters. If processing of that upload
+// wasn't confirmed yet, its ID is returned as pending.
+func (state *uploadState) lookup(source *Source, localeFile *LocaleFile) (unchanged bool, pending string) {
+	record, err := newUploadRecord(source, localeFile)
+	if err != nil {
+		return false, ""
+	}
+
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	last, found := state.Uploads[state.key(source, localeFile)]
+	if !found || !last.matches(record) {
+		return false, ""
+	}
+	return true, last.UploadID
+}
+
+// record marks the locale file as uploaded successfully.
+func (state *uploadState) record(source *Source, localeFile *LocaleFile) error {
+	return state.recordUpload(source, localeFile, "")
+}
+
+// recordPending marks the locale file as uploaded with the given upload ID,
+// whose processing result isn't known yet.
+func (state *uploadState) recordPending(source *Source, localeFile *LocaleFile, uploadID string) error {
+	return state.recordUpload(source, localeFile, uploadID)
+}
+
+func (state *uploadState) recordUpload(source *Source, localeFile *LocaleFile, uploadID string) error {
+	record, err := newUploadRecord(source, localeFile)
+	if err != nil {
+		return err
+	}
+	record.UploadID = uploadID
+
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	state.Uploads[state.key(source, localeFile)] = record
+	return nil
+}
+
+// confirm marks the pending upload of the locale file as processed
+// successfully.
+func (state *uploadState) confirm(source *Source, localeFile *LocaleFile) {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	if record, found := state.Uploads[state.key(source, localeFile)]; found {
+		record.UploadID = ""
+	}
+}
+
+// newUploadRecord hashes the content of the locale file together with the
+// upload parameters, as changing those should result in a new upload, too.
+func newUploadRecord(source *Source, localeFile *LocaleFile) (*uploadRecord, error) {
+	content, err := ioutil.ReadFile(localeFile.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	params, err := json.Marshal(source.Params)
+	if err != nil {
+		return nil, err
+	}
+
+	h := sha256.New()
+	h.Write(content)
+	h.Write([]byte{0})
+	h.Write(params)
+	h.Write([]byte{0})
+	h.Write([]byte(localeFile.Tag))
+
+	locale := localeFile.ID
+	if locale == "" {
+		locale = localeFile.Code
+	}
+	if locale == "" {
+		locale = localeFile.Name
+	}
+
+	return &uploadRecord{
+		ProjectID: source.ProjectID,
+		Locale:    locale,
+		Hash:      hex.EncodeToString(h.Sum(nil)),
+	}, nil
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/phrase/phraseapp-go/phraseapp"
+)
+
+type uploadCounter struct {
+	mu      sync.Mutex
+	uploads int
+
+	// processed is the state uploads are reported in once they are shown.
+	processed string
+}
+
+func (uc *uploadCounter) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	uc.mu.Lock()
+	defer uc.mu.Unlock()
+
+	if strings.HasSuffix(req.URL.Path, "/uploads") {
+		uc.uploads++
+		resp.WriteHeader(http.StatusCreated)
+		fmt.Fprint(resp, `{"id": "upload-id", "state": "success"}`)
+		return
+	}
+
+	state := uc.processed
+	if state == "" {
+		state = "success"
+	}
+	fmt.Fprintf(resp, `{"id": "upload-id", "state": %q}`, state)
+}
+
+func (uc *uploadCounter) setProcessed(state string) {
+	uc.mu.Lock()
+	defer uc.mu.Unlock()
+	uc.processed = state
+}
+
+func (uc *uploadCounter) count() int {
+	uc.mu.Lock()
+	defer uc.mu.Unlock()
+	n := uc.uploads
+	uc.uploads = 0
+	return n
+}
+
+func TestPushSkipsUnchangedFiles(t *testing.T) {
+	d := setupFiles(t, "en.yml", "de.yml")
+	defer os.RemoveAll(d)
+
+	defer func(dir string) { configDir = dir }(configDir)
+	configDir = d
+
+	uc := new(uploadCounter)
+	srv := httptest.NewServer(uc)
+	defer srv.Close()
+
+	c, err := newClient(phraseapp.Credentials{Host: srv.URL, Token: "some_token"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	source := getBaseSource()
+	source.File = filepath.Join(d, "<locale_code>.yml")
+	source.Format = new(phraseapp.Format)
+
+	push := func(force bool) int {
+		cmd := &PushCommand{Parallel: 2, Force: force}
+		if err := cmd.push(c, Sources{source}); err != nil {
+			t.Fatalf("didn't expect an error, got: %s", err)
+		}
+		return uc.count()
+	}
+
+	if n := push(false); n != 2 {
+		t.Errorf("expected 2 uploads on first push, got %d", n)
+	}
+	if n := push(false); n != 0 {
+		t.Errorf("expected unchanged files to be skipped, got %d uploads", n)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(d, "de.yml"), []byte("de:\n  a: b\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if n := push(false); n != 1 {
+		t.Errorf("expected only the changed file to be uploaded, got %d uploads", n)
+	}
+
+	tags := "other"
+	source.Params.Tags = &tags
+	if n := push(false); n != 2 {
+		t.Errorf("expected changed params to result in new uploads, got %d uploads", n)
+	}
+
+	if n := push(true); n != 2 {
+		t.Errorf("expected force to upload all files, got %d uploads", n)
+	}
+
+	state, err := loadUploadState(filepath.Join(d, uploadStateFileName))
+	if err != nil {
+		t.Fatalf("didn't expect an error, got: %s", err)
+	}
+	record, found := state.Uploads["project-id:en.yml"]
+	if !found {
+		t.Fatalf("expected state to contain en.yml, got %v", state.Uploads)
+	}
+	if record.ProjectID != "project-id" || record.Locale != "en-locale-id" {
+		t.Errorf("unexpected record for en.yml: %+v", record)
+	}
+}
+
+func TestPushUploadsFilesWithUnknownProcessingResult(t *testing.T) {
+	d := setupFiles(t, "en.yml")
+	defer os.RemoveAll(d)
+
+	defer func(dir string) { configDir = dir }(configDir)
+	configDir = d
+
+	uc := new(uploadCounter)
+	srv := httptest.NewServer(uc)
+	defer srv.Close()
+
+	c, err := newClient(phraseapp.Credentials{Host: srv.URL, Token: "some_token"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	source := getBaseSource()
+	source.File = filepath.Join(d, "<locale_code>.yml")
+	source.Format = new(phraseapp.Format)
+
+	push := func() int {
+		cmd := &PushCommand{Parallel: 1}
+		if err := cmd.push(c, Sources{source}); err != nil {
+			t.Fatalf("didn't expect an error, got: %s", err)
+		}
+		return uc.count()
+	}
+
+	if n := push(); n != 1 {
+		t.Fatalf("expected 1 upload on first push, got %d", n)
+	}
+
+	uc.setProcessed("error")
+	if n := push(); n != 1 {
+		t.Errorf("expected file whose processing failed to be uploaded again, got %d uploads", n)
+	}
+
+	uc.setProcessed("success")
+	if n := push(); n != 0 {
+		t.Errorf("expected processed file to be skipped, got %d uploads", n)
+	}
+
+	state, err := loadUploadState(filepath.Join(d, uploadStateFileName))
+	if err != nil {
+		t.Fatalf("didn't expect an error, got: %s", err)
+	}
+	if record := state.Uploads["project-id:en.yml"]; record == nil || record.UploadID != "" {
+		t.Errorf("expected processed upload to be confirmed, got %+v", record)
+	}
+
+	uc.setProcessed("error")
+	if n := push(); n != 0 {
+		t.Errorf("expected confirmed upload not to be checked again, got %d uploads", n)
+	}
+}
+
+func TestPushRecordsUploadsPerProject(t *testing.T) {
+	d := setupFiles(t, "en.yml")
+	defer os.RemoveAll(d)
+
+	defer func(dir string) { configDir = dir }(configDir)
+	configDir = d
+
+	uc := new(uploadCounter)
+	srv := httptest.NewServer(uc)
+	defer srv.Close()
+
+	c, err := newClient(phraseapp.Credentials{Host: srv.URL, Token: "some_token"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	source := getBaseSource()
+	source.File = filepath.Join(d, "<locale_code>.yml")
+	source.Format = new(phraseapp.Format)
+
+	other := getBaseSource()
+	other.File = source.File
+	other.Format = source.Format
+	other.ProjectID = "other-project-id"
+
+	cmd := &PushCommand{Parallel: 1, Wait: true}
+	if err := cmd.push(c, Sources{source, other}); err != nil {
+		t.Fatalf("didn't expect an error, got: %s", err)
+	}
+	if n := uc.count(); n != 2 {
+		t.Fatalf("expected the file to be uploaded to both projects, got %d uploads", n)
+	}
+
+	cmd = &PushCommand{Parallel: 1, Wait: true}
+	if err := cmd.push(c, Sources{source, other}); err != nil {
+		t.Fatalf("didn't expect an error, got: %s", err)
+	}
+	if n := uc.count(); n != 0 {
+		t.Errorf("expected unchanged files to be skipped for both projects, got %d uploads", n)
+	}
+}